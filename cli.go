@@ -0,0 +1,340 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// programName is the name the program was run as, used in usage messages. build.sh installs it as masq, while go build
+// names it go-encryption-program.
+var programName = filepath.Base(os.Args[0])
+
+// Exit codes of the program.
+const (
+	exitOK    = 0
+	exitError = 1
+	// The command line was invalid, such as an unknown flag or a missing argument.
+	exitUsage = 2
+)
+
+// cli is where a command prints its output.
+type cli struct {
+	stdout io.Writer
+	stderr io.Writer
+	// Whether --json was given.
+	json bool
+	// The result printed with --json.
+	result result
+	// True if the command writes its data to stdout, so messages go to stderr.
+	dataOnStdout bool
+}
+
+// command is a subcommand of the program.
+type command struct {
+	// Positional arguments, shown in the usage.
+	Arguments   []string
+	Description string
+	// Names of the flags the command accepts, from flagDefinitions.
+	Flags []string
+	// Number of positional arguments allowed. If MaxArgs is -1, there is no limit.
+	MinArgs int
+	MaxArgs int
+	// Run runs the command with the parsed flags and positional arguments.
+	Run func(c *cli, o *options, args []string) error
+}
+
+// options are the values of all flags. Every command only defines the flags it accepts.
+type options struct {
+	force        bool
+	metadata     bool
+	keyIds       bool
+	originalName bool
+	out          string
+	interactive  bool
+	words        bool
+	wordlist     *humanize.Wordlist
+	size         int
+	timeout      time.Duration
+	matches      string
+	json         bool
+}
+
+// wordlistFlag is a flag.Value for --wordlist, loading the word list when it is parsed.
+type wordlistFlag struct {
+	wordlist **humanize.Wordlist
+	name     string
+}
+
+func (f *wordlistFlag) String() string {
+	return f.name
+}
+
+func (f *wordlistFlag) Set(name string) error {
+	wordlist, err := loadWordlist(name)
+	if err != nil {
+		return err
+	}
+	*f.wordlist = wordlist
+	f.name = name
+	return nil
+}
+
+// flagDefinitions defines every flag on a flag set, storing its value in o.
+var flagDefinitions = map[string]func(fs *flag.FlagSet, o *options){
+	"force": func(fs *flag.FlagSet, o *options) {
+		fs.BoolVar(&o.force, "force", false, "replace the output if it already exists")
+	},
+	"metadata": func(fs *flag.FlagSet, o *options) {
+		fs.BoolVar(&o.metadata, "metadata", false, "encrypt the name, mode, modification time, size and content type of the file")
+	},
+	"key-ids": func(fs *flag.FlagSet, o *options) {
+		fs.BoolVar(&o.keyIds, "key-ids", false, "write the key ID of every recipient, so the wrong private key fails with the fingerprints the file is for. this reveals the recipients to anyone with their public keys")
+	},
+	"original-name": func(fs *flag.FlagSet, o *options) {
+		fs.BoolVar(&o.originalName, "original-name", false, "save to the original name from the metadata, next to the encrypted file")
+	},
+	"o": func(fs *flag.FlagSet, o *options) {
+		fs.StringVar(&o.out, "o", "", "save the output to `outpath`, or - for stdout")
+	},
+	"interactive": func(fs *flag.FlagSet, o *options) {
+		fs.BoolVar(&o.interactive, "interactive", false, "ask before correcting a misspelled word")
+	},
+	"words": func(fs *flag.FlagSet, o *options) {
+		fs.BoolVar(&o.words, "words", false, "also print every share as words")
+	},
+	"wordlist": func(fs *flag.FlagSet, o *options) {
+		fs.Var(&wordlistFlag{wordlist: &o.wordlist, name: "default"}, "wordlist", "`name or file` of the word list: default, pgp, or a file with 256 words, one per line")
+	},
+	"size": func(fs *flag.FlagSet, o *options) {
+		fs.IntVar(&o.size, "size", 32, "number of `bytes` the words decode to, or 0 for any number, in which case the words must end with checksum words")
+	},
+	"timeout": func(fs *flag.FlagSet, o *options) {
+		fs.DurationVar(&o.timeout, "timeout", 0, "stop searching after `duration`, such as 10m or 2h")
+	},
+	"matches": func(fs *flag.FlagSet, o *options) {
+		fs.StringVar(&o.matches, "matches", "", "keep searching until stopped, appending every key found to `file`")
+	},
+	"json": func(fs *flag.FlagSet, o *options) {
+		fs.BoolVar(&o.json, "json", false, "print the result, or the error, as JSON")
+	},
+}
+
+// commonFlags are the flags every command accepts. They are not shown in the usage line.
+var commonFlags = []string{"json"}
+
+// usageError is returned for an invalid command line. The usage of the command is printed with it.
+type usageError struct {
+	Message string
+}
+
+func (e *usageError) Error() string {
+	return e.Message
+}
+
+// newUsageError returns a usageError with message.
+func newUsageError(message string) error {
+	return &usageError{Message: message}
+}
+
+// flagSet returns the flag set of cmd, with its flags stored in o.
+func (cmd command) flagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	// Errors and help are printed by run.
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	for _, flagName := range cmd.allFlags() {
+		flagDefinitions[flagName](fs, o)
+	}
+	return fs
+}
+
+// allFlags returns the names of the flags of cmd, followed by commonFlags.
+func (cmd command) allFlags() []string {
+	return append(append([]string{}, cmd.Flags...), commonFlags...)
+}
+
+// hasJSONFlag reports whether args has --json before the positional arguments. It is used when the flags could not be
+// parsed.
+func hasJSONFlag(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		switch strings.TrimLeft(arg, "-") {
+		case "json", "json=true", "json=1":
+			return true
+		}
+	}
+	return false
+}
+
+// usage returns the usage line of cmd, such as "encrypt-file [--force] <filepath>".
+func (cmd command) usage(name string) string {
+	fs := cmd.flagSet(name, &options{})
+	parts := []string{name}
+	for _, flagName := range cmd.Flags {
+		parts = append(parts, "["+flagSyntax(fs.Lookup(flagName))+"]")
+	}
+	return strings.Join(append(parts, cmd.Arguments...), " ")
+}
+
+// flagSyntax returns how f is written on the command line, such as "--force" or "-o <outpath>". Flags with one letter
+// are written with a single dash.
+func flagSyntax(f *flag.Flag) string {
+	syntax := "--" + f.Name
+	if len(f.Name) == 1 {
+		syntax = "-" + f.Name
+	}
+	if isBoolFlag(f) {
+		return syntax
+	}
+	valueName, _ := flag.UnquoteUsage(f)
+	return syntax + " <" + valueName + ">"
+}
+
+// isBoolFlag reports whether f is a flag without a value, such as --force.
+func isBoolFlag(f *flag.Flag) bool {
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && boolFlag.IsBoolFlag()
+}
+
+// checkArgs returns a usageError if args is not the number of positional arguments cmd accepts.
+func (cmd command) checkArgs(args []string) error {
+	if len(args) >= cmd.MinArgs && (cmd.MaxArgs == -1 || len(args) <= cmd.MaxArgs) {
+		return nil
+	}
+	// The noun agrees with the last number in the message.
+	expected, last := strconv.Itoa(cmd.MinArgs), cmd.MinArgs
+	if cmd.MaxArgs == -1 {
+		expected = "at least " + expected
+	} else if cmd.MinArgs == 0 && cmd.MaxArgs > 0 {
+		expected, last = "at most "+strconv.Itoa(cmd.MaxArgs), cmd.MaxArgs
+	} else if cmd.MaxArgs != cmd.MinArgs {
+		expected, last = "between "+expected+" and "+strconv.Itoa(cmd.MaxArgs), cmd.MaxArgs
+	}
+	noun := " arguments"
+	if last == 1 {
+		noun = " argument"
+	}
+	return newUsageError("expected " + expected + noun + ", got " + strconv.Itoa(len(args)))
+}
+
+// printHelp prints every command to w, sorted by name.
+func printHelp(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "OwO Encryption Standard. Essentially NaCL box with chunk support.")
+	fmt.Fprintln(w, "Usage: "+programName+" <command> [<flags>] [<arguments>]")
+	fmt.Fprintln(w, "Run \""+programName+" help <command>\" or \""+programName+" <command> --help\" for the flags of a command. Every command accepts --json to print its result as JSON.")
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		cmd := commands[name]
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, cmd.usage(name))
+		fmt.Fprintln(w, "    "+cmd.Description)
+	}
+}
+
+// printCommandHelp prints the usage, description and flags of the command called name to w.
+func printCommandHelp(w io.Writer, name string) {
+	cmd := commands[name]
+	fmt.Fprintln(w, "Usage: "+programName+" "+cmd.usage(name))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, cmd.Description)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	fs := cmd.flagSet(name, &options{})
+	for _, flagName := range cmd.allFlags() {
+		f := fs.Lookup(flagName)
+		_, usage := flag.UnquoteUsage(f)
+		fmt.Fprintln(w, "  "+flagSyntax(f))
+		fmt.Fprintln(w, "        "+usage)
+	}
+}
+
+// run runs the command line args, without the program name, and returns the exit code.
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	c := &cli{stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		printHelp(stderr)
+		return exitUsage
+	}
+	name := args[0]
+	if name == "--help" || name == "-h" {
+		name = "help"
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		c.json = hasJSONFlag(args[1:])
+		return c.exit(name, newUsageError("unknown command \""+name+"\""))
+	}
+	o := &options{wordlist: humanize.Default}
+	fs := cmd.flagSet(name, o)
+	err := fs.Parse(args[1:])
+	c.json = o.json
+	if err == flag.ErrHelp {
+		err = c.help([]string{name})
+	} else if err != nil {
+		// The flags after the invalid one were not parsed.
+		c.json = hasJSONFlag(args[1:])
+		err = newUsageError(err.Error())
+	} else if err = cmd.checkArgs(fs.Args()); err == nil {
+		if name == "help" {
+			err = c.help(fs.Args())
+		} else {
+			err = cmd.Run(c, o, fs.Args())
+		}
+	}
+	return c.exit(name, err)
+}
+
+// help prints the help of the commands in names, or of every command if names is empty.
+func (c *cli) help(names []string) error {
+	for _, name := range names {
+		if _, ok := commands[name]; !ok {
+			return newUsageError("unknown command \"" + name + "\"")
+		}
+	}
+	c.print(newHelpOutput(names))
+	return nil
+}
+
+// exit prints err, if the command called name failed, and returns the exit code. With --json, the result is printed
+// too.
+func (c *cli) exit(name string, err error) int {
+	if c.json {
+		c.printJSON(name, err)
+	} else if err != nil {
+		fmt.Fprintln(c.stderr, "error: "+err.Error())
+		if _, ok := err.(*usageError); ok {
+			if cmd, ok := commands[name]; ok {
+				fmt.Fprintln(c.stderr, "Usage: "+programName+" "+cmd.usage(name))
+				fmt.Fprintln(c.stderr, "Run \""+programName+" help "+name+"\" for more information.")
+			} else {
+				fmt.Fprintln(c.stderr, "Run \""+programName+" help\" for a list of commands.")
+			}
+		}
+	}
+	if err == nil {
+		return exitOK
+	}
+	if _, ok := err.(*usageError); ok {
+		return exitUsage
+	}
+	return exitError
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
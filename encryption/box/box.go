@@ -5,6 +5,7 @@ import (
 	crypto_ran "crypto/rand"
 	"errors"
 	"golang.org/x/crypto/nacl/box"
+	"strconv"
 )
 
 func GenerateKeys() ([]byte, []byte, error) {
@@ -15,8 +16,20 @@ func GenerateKeys() ([]byte, []byte, error) {
 	return publicKey[:], privateKey[:], nil
 }
 
+// GetPublicKey returns the public key belonging to privateKey.
+func GetPublicKey(privateKey []byte) ([]byte, error) {
+	keyData, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return keyData.PublicKey().Bytes(), nil
+}
+
 // Encrypt encrypts the plainText using publicKey and returns the encrypted text.
 func Encrypt(publicKey []byte, plainText []byte) ([]byte, error) {
+	if len(publicKey) != 32 {
+		return nil, errors.New("invalid public key size: " + strconv.Itoa(len(publicKey)))
+	}
 	data, err := box.SealAnonymous(nil, plainText, (*[32]byte)(publicKey), crypto_ran.Reader)
 	if err != nil {
 		return nil, err
@@ -29,7 +42,7 @@ func Decrypt(privateKey []byte, encryptedData []byte) ([]byte, error) {
 	// get public key from private key
 	keyData, err := ecdh.X25519().NewPrivateKey(privateKey)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	publicKey := keyData.PublicKey().Bytes()
 	// decrypt
@@ -44,3 +57,37 @@ func DecryptWithPublicKey(publicKey []byte, privateKey []byte, encryptedData []b
 	}
 	return data, nil
 }
+
+// AuthenticatedOverhead is the number of bytes EncryptAuthenticated adds to a message: the sender's public key, the nonce and the box overhead.
+const AuthenticatedOverhead = 32 + 24 + box.Overhead
+
+// EncryptAuthenticated encrypts the plainText from senderPrivateKey to publicKey, and returns the sender's public key, a random nonce and the encrypted text.
+func EncryptAuthenticated(senderPrivateKey []byte, publicKey []byte, plainText []byte) ([]byte, error) {
+	senderPublicKey, err := GetPublicKey(senderPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(publicKey) != 32 {
+		return nil, errors.New("invalid public key size: " + strconv.Itoa(len(publicKey)))
+	}
+	var nonce [24]byte
+	if _, err := crypto_ran.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	data := append(senderPublicKey, nonce[:]...)
+	return box.Seal(data, plainText, &nonce, (*[32]byte)(publicKey), (*[32]byte)(senderPrivateKey)), nil
+}
+
+// DecryptAuthenticated decrypts the encryptedData created by EncryptAuthenticated using privateKey and returns the plain text and the sender's public key.
+func DecryptAuthenticated(privateKey []byte, encryptedData []byte) ([]byte, []byte, error) {
+	if len(encryptedData) < AuthenticatedOverhead || len(privateKey) != 32 {
+		return nil, nil, errors.New("decryption failed")
+	}
+	senderPublicKey := encryptedData[:32]
+	nonce := (*[24]byte)(encryptedData[32:56])
+	data, ok := box.Open(nil, encryptedData[56:], nonce, (*[32]byte)(senderPublicKey), (*[32]byte)(privateKey))
+	if !ok {
+		return nil, nil, errors.New("decryption failed")
+	}
+	return data, append([]byte{}, senderPublicKey...), nil
+}
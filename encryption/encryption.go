@@ -1,18 +1,63 @@
 package encryption
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/masquernya/go-encryption-program/encryption/box"
+	"strings"
 )
 
 const (
 	MagicBytesVersion1 string = "OwO1"
+	// MagicBytesVersion2 binds every chunk to its position in the stream and marks the final chunk, so reordered,
+	// duplicated or missing chunks are detected.
+	MagicBytesVersion2 string = "OwO2"
+	// MagicBytesVersion3 uses a single ephemeral key for the whole stream and seals chunks with ChaCha20-Poly1305,
+	// which is much faster than a box per chunk. Chunks are bound to their position like MagicBytesVersion2.
+	MagicBytesVersion3 string = "OwO3"
+	// MagicBytesVersion4 wraps a random file key for one or more recipients, then seals chunks like
+	// MagicBytesVersion3.
+	MagicBytesVersion4 string = "OwO4"
 )
 
+// DefaultVersion is the format version written by NewEncryptReader and NewEncryptReaderWithBufferSize.
+const DefaultVersion = MagicBytesVersion4
+
 func GenerateKeys() ([]byte, []byte, error) {
 	return box.GenerateKeys()
 }
 
+// GetPublicKey returns the public key belonging to privateKey.
+func GetPublicKey(privateKey []byte) ([]byte, error) {
+	return box.GetPublicKey(privateKey)
+}
+
+// KeyIdSize is the size of the key ID returned by KeyId.
+const KeyIdSize = 8
+
+// KeyId returns a short identifier for publicKey: the first 8 bytes of its SHA-256 hash.
+func KeyId(publicKey []byte) []byte {
+	h := sha256.Sum256(publicKey)
+	return h[:KeyIdSize]
+}
+
+// Fingerprint returns the key ID of publicKey as hex, in groups of 4 characters, such as "1a2b-3c4d-5e6f-7a8b".
+func Fingerprint(publicKey []byte) string {
+	return formatKeyId(KeyId(publicKey))
+}
+
+func formatKeyId(keyId []byte) string {
+	s := hex.EncodeToString(keyId)
+	var groups []string
+	for i := 0; i < len(s); i += 4 {
+		groups = append(groups, s[i:i+4])
+	}
+	return strings.Join(groups, "-")
+}
+
 const defaultBufferSize int = 1024 * 16 // 16kb
+// Right now, up to 128MB is recommended, but we'll allow up to 1GB.
+const maxBufferSize int = 1024 * 1024 * 1024
 
 // PublicKeyEncrypt encrypts the plainText using publicKey and returns the encrypted text.
 func PublicKeyEncrypt(publicKey []byte, plainText []byte) ([]byte, error) {
@@ -24,6 +69,16 @@ func PublicKeyDecrypt(privateKey []byte, encryptedData []byte) ([]byte, error) {
 	return box.Decrypt(privateKey, encryptedData)
 }
 
+// AuthenticatedEncrypt encrypts the plainText from the owner of senderPrivateKey to publicKey and returns the encrypted text. Unlike PublicKeyEncrypt, the recipient can verify who sent it.
+func AuthenticatedEncrypt(senderPrivateKey []byte, publicKey []byte, plainText []byte) ([]byte, error) {
+	return box.EncryptAuthenticated(senderPrivateKey, publicKey, plainText)
+}
+
+// AuthenticatedDecrypt decrypts the encryptedData created by AuthenticatedEncrypt using privateKey and returns the plain text and the public key of the sender. Decryption only succeeds if the sender really owns that public key, but you must still check that it is the sender you expect.
+func AuthenticatedDecrypt(privateKey []byte, encryptedData []byte) ([]byte, []byte, error) {
+	return box.DecryptAuthenticated(privateKey, encryptedData)
+}
+
 // DecryptWithPublicKey decrypts the encryptedData using the publicKey/privateKey pair and returns the plain text. The publicKey and privateKey must both belong to the recipient - this method only decrypts anonymous messages. You probably want to use PublicKeyDecrypt instead, unless you know what you're doing.
 func DecryptWithPublicKey(publicKey []byte, privateKey []byte, encryptedData []byte) ([]byte, error) {
 	return box.DecryptWithPublicKey(publicKey, privateKey, encryptedData)
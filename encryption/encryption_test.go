@@ -5,10 +5,14 @@ import (
 	crypto_ran "crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"golang.org/x/crypto/chacha20poly1305"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
@@ -140,3 +144,811 @@ func TestEncryptReader(t *testing.T) {
 		t.Fatal("decrypted data does not match original")
 	}
 }
+
+func encryptDecrypt(t *testing.T, version string, data []byte, bufferSize int) {
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := io.ReadAll(NewEncryptReaderWithVersion(publicKey, bytes.NewReader(data), bufferSize, version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encrypted[:len(version)]) != version {
+		t.Fatal("wrong magic bytes", string(encrypted[:len(version)]))
+	}
+	decrypted, err := io.ReadAll(NewDecryptReader(privateKey, bytes.NewReader(encrypted)))
+	if err != nil {
+		t.Fatal(version, len(data), err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Fatal(version, "decrypted data does not match original for size", len(data))
+	}
+}
+
+func TestEncryptReaderVersions(t *testing.T) {
+	data := make([]byte, 1024*5+7)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{MagicBytesVersion1, MagicBytesVersion2, MagicBytesVersion3, MagicBytesVersion4} {
+		for _, size := range []int{0, 1, 1023, 1024, 1025, 1024 * 2, len(data)} {
+			encryptDecrypt(t, version, data[:size], 1024)
+		}
+	}
+}
+
+// streamChunks encrypts data and splits the result into the header and the encrypted chunks.
+func streamChunks(t *testing.T, version string, publicKey []byte, data []byte, bufferSize int) ([]byte, [][]byte) {
+	encrypted, err := io.ReadAll(NewEncryptReaderWithVersion(publicKey, bytes.NewReader(data), bufferSize, version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerSize := len(version) + 4
+	chunkSize := bufferSize
+	switch version {
+	case MagicBytesVersion2:
+		headerSize += version2StreamIdSize
+		chunkSize += (&version2Opener{}).overhead()
+	case MagicBytesVersion3:
+		headerSize += 32
+		chunkSize += chacha20poly1305.Overhead
+	case MagicBytesVersion4:
+		headerSize += 2 + 3 + 80
+		chunkSize += chacha20poly1305.Overhead
+	}
+	header := encrypted[:headerSize]
+	var chunks [][]byte
+	for rest := encrypted[headerSize:]; len(rest) > 0; {
+		n := chunkSize
+		if len(rest) < n {
+			n = len(rest)
+		}
+		chunks = append(chunks, rest[:n])
+		rest = rest[n:]
+	}
+	return header, chunks
+}
+
+func TestStreamDetectsTampering(t *testing.T) {
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1024*3+100)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{MagicBytesVersion2, MagicBytesVersion3, MagicBytesVersion4} {
+		header, chunks := streamChunks(t, version, publicKey, data, 1024)
+		if len(chunks) != 4 {
+			t.Fatal("expected 4 chunks, got", len(chunks))
+		}
+		_, otherChunks := streamChunks(t, version, publicKey, data, 1024)
+		flipped := append([]byte{}, chunks[1]...)
+		flipped[len(flipped)/2] ^= 1
+
+		tests := []struct {
+			name   string
+			chunks [][]byte
+			err    error
+		}{
+			{"reordered", [][]byte{chunks[1], chunks[0], chunks[2], chunks[3]}, ErrCorrupt},
+			{"duplicated", [][]byte{chunks[0], chunks[0], chunks[1], chunks[2], chunks[3]}, ErrCorrupt},
+			{"dropped", [][]byte{chunks[0], chunks[2], chunks[3]}, ErrCorrupt},
+			{"truncated", [][]byte{chunks[0], chunks[1], chunks[2]}, ErrTruncated},
+			{"cut mid-chunk", [][]byte{chunks[0], chunks[1], chunks[2][:100]}, ErrCorrupt},
+			{"flipped", [][]byte{chunks[0], flipped, chunks[2], chunks[3]}, ErrCorrupt},
+			{"appended", [][]byte{chunks[0], chunks[1], chunks[2], chunks[3], chunks[3]}, ErrCorrupt},
+			{"spliced", [][]byte{chunks[0], otherChunks[1], chunks[2], chunks[3]}, ErrCorrupt},
+		}
+		if version == MagicBytesVersion2 {
+			tests[0].err = ErrChunkOrder
+			tests[1].err = ErrChunkOrder
+			tests[2].err = ErrChunkOrder
+			tests[7].err = ErrChunkOrder
+		}
+		for _, test := range tests {
+			stream := bytes.NewBuffer(nil)
+			stream.Write(header)
+			for _, chunk := range test.chunks {
+				stream.Write(chunk)
+			}
+			_, err := io.ReadAll(NewDecryptReader(privateKey, stream))
+			if err != test.err {
+				t.Fatal(version, test.name, "expected error", test.err, "got", err)
+			}
+		}
+	}
+}
+
+func TestMultiEncryptReader(t *testing.T) {
+	data := make([]byte, 1024*3)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	var publicKeys, privateKeys [][]byte
+	for i := 0; i < 3; i++ {
+		publicKey, privateKey, err := GenerateKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+		privateKeys = append(privateKeys, privateKey)
+	}
+	encrypted, err := io.ReadAll(NewMultiEncryptReader(publicKeys, bytes.NewReader(data), 1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, privateKey := range privateKeys {
+		decrypted, err := io.ReadAll(NewDecryptReader(privateKey, bytes.NewReader(encrypted)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, data) {
+			t.Fatal("decrypted data does not match original")
+		}
+	}
+
+	_, otherPrivateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(NewDecryptReader(otherPrivateKey, bytes.NewReader(encrypted)))
+	recipientErr, ok := err.(*RecipientError)
+	if !ok {
+		t.Fatal("expected RecipientError, got", err)
+	}
+	if recipientErr.Recipients != 3 {
+		t.Fatal("expected 3 recipients, got", recipientErr.Recipients)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	data := make([]byte, 1024*3)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := &Metadata{
+		Name:        "backup.sql",
+		Mode:        0640,
+		ModTime:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Size:        int64(len(data)),
+		ContentType: "application/sql",
+	}
+	encrypted, err := io.ReadAll(NewEncryptReaderWithOptions([][]byte{publicKey}, bytes.NewReader(data), EncryptOptions{BufferSize: 1024, Metadata: metadata}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadMetadata(privateKey, bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *read != *metadata {
+		t.Fatal("expected metadata", metadata, "got", read)
+	}
+	d := &StreamDecryption{DataProvider: bytes.NewReader(encrypted), privateKey: privateKey}
+	decrypted, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Fatal("decrypted data does not match original")
+	}
+	if d.Metadata() == nil || d.Metadata().Name != metadata.Name {
+		t.Fatal("expected metadata from StreamDecryption, got", d.Metadata())
+	}
+
+	// The metadata stanza is last, so flipping a byte of its body breaks the metadata and every chunk.
+	headerSize := len(encrypted) - 3*(1024+chacha20poly1305.Overhead) - chacha20poly1305.Overhead
+	tampered := append([]byte{}, encrypted...)
+	tampered[headerSize-1] ^= 1
+	if _, err := ReadMetadata(privateKey, bytes.NewReader(tampered)); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	_, otherPrivateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMetadata(otherPrivateKey, bytes.NewReader(encrypted)); err == nil {
+		t.Fatal("expected an error")
+	} else if recipientErr, ok := err.(*RecipientError); !ok || recipientErr.Recipients != 1 {
+		t.Fatal("expected RecipientError for 1 recipient, got", err)
+	}
+
+	_, err = io.ReadAll(NewEncryptReaderWithOptions([][]byte{publicKey}, bytes.NewReader(data), EncryptOptions{Version: MagicBytesVersion3, Metadata: metadata}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestKeyIds(t *testing.T) {
+	data := make([]byte, 1024*3)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	var publicKeys, privateKeys [][]byte
+	for i := 0; i < 2; i++ {
+		publicKey, privateKey, err := GenerateKeys()
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+		privateKeys = append(privateKeys, privateKey)
+	}
+	if fingerprint := Fingerprint(publicKeys[0]); len(fingerprint) != 19 || strings.Count(fingerprint, "-") != 3 {
+		t.Fatal("invalid fingerprint", fingerprint)
+	}
+	encrypted, err := io.ReadAll(NewEncryptReaderWithOptions(publicKeys, bytes.NewReader(data), EncryptOptions{BufferSize: 1024, IncludeKeyIds: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, privateKey := range privateKeys {
+		decrypted, err := io.ReadAll(NewDecryptReader(privateKey, bytes.NewReader(encrypted)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, data) {
+			t.Fatal("decrypted data does not match original")
+		}
+	}
+
+	_, otherPrivateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(NewDecryptReader(otherPrivateKey, bytes.NewReader(encrypted)))
+	recipientErr, ok := err.(*RecipientError)
+	if !ok {
+		t.Fatal("expected RecipientError, got", err)
+	}
+	expected := "wrong private key, this file is for " + Fingerprint(publicKeys[0]) + ", " + Fingerprint(publicKeys[1])
+	if recipientErr.Error() != expected {
+		t.Fatal("expected", expected, "got", recipientErr.Error())
+	}
+
+	_, err = io.ReadAll(NewEncryptReaderWithOptions(publicKeys[:1], bytes.NewReader(data), EncryptOptions{Version: MagicBytesVersion3, IncludeKeyIds: true}))
+	if err == nil {
+		t.Fatal("expected error for key IDs with version 3")
+	}
+}
+
+// chunkedWriter writes p to w in pieces of at most size bytes.
+func chunkedWriter(w io.Writer, p []byte, size int) error {
+	for len(p) > 0 {
+		n := size
+		if len(p) < n {
+			n = len(p)
+		}
+		if _, err := w.Write(p[:n]); err != nil {
+			return err
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+func TestEncryptWriter(t *testing.T) {
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1024*3+7)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{MagicBytesVersion1, MagicBytesVersion2, MagicBytesVersion3, MagicBytesVersion4} {
+		for _, size := range []int{0, 1, 1024, 1025, 1024 * 3, len(data)} {
+			for _, writeSize := range []int{1, 100, 1024, 4096} {
+				// Writer to reader
+				encrypted := bytes.NewBuffer(nil)
+				w := NewEncryptWriterWithVersion(publicKey, encrypted, 1024, version)
+				if err := chunkedWriter(w, data[:size], writeSize); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				encryptedLen := encrypted.Len()
+				decrypted, err := io.ReadAll(NewDecryptReader(privateKey, encrypted))
+				if err != nil {
+					t.Fatal(version, size, writeSize, err)
+				}
+				if !bytes.Equal(decrypted, data[:size]) {
+					t.Fatal(version, size, writeSize, "decrypted data does not match original")
+				}
+
+				// Reader to writer
+				readerEncrypted, err := io.ReadAll(NewEncryptReaderWithVersion(publicKey, bytes.NewReader(data[:size]), 1024, version))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(readerEncrypted) != encryptedLen {
+					// Both must produce the same layout, so the sizes match.
+					t.Fatal(version, size, "reader and writer sizes differ", len(readerEncrypted), encryptedLen)
+				}
+				plain := bytes.NewBuffer(nil)
+				dw := NewDecryptWriter(privateKey, plain)
+				if err := chunkedWriter(dw, readerEncrypted, writeSize); err != nil {
+					t.Fatal(err)
+				}
+				if err := dw.Close(); err != nil {
+					t.Fatal(version, size, writeSize, err)
+				}
+				if !bytes.Equal(plain.Bytes(), data[:size]) {
+					t.Fatal(version, size, writeSize, "decrypted data does not match original")
+				}
+			}
+		}
+	}
+}
+
+func TestDecryptWriterTruncated(t *testing.T) {
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, chunks := streamChunks(t, MagicBytesVersion4, publicKey, make([]byte, 1024*2), 1024)
+	dw := NewDecryptWriter(privateKey, io.Discard)
+	if _, err := dw.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	// Leave out the empty final chunk.
+	for _, chunk := range chunks[:len(chunks)-1] {
+		if _, err := dw.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dw.Close(); err != ErrTruncated {
+		t.Fatal("expected ErrTruncated, got", err)
+	}
+}
+
+func TestParallelReaders(t *testing.T) {
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1024*20+3)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{MagicBytesVersion1, MagicBytesVersion2, MagicBytesVersion3, MagicBytesVersion4} {
+		for _, size := range []int{0, 1, 1024, 1024 * 20, len(data)} {
+			for _, workers := range []int{1, 3, 16} {
+				encrypted, err := io.ReadAll(NewParallelEncryptReaderWithOptions([][]byte{publicKey}, bytes.NewReader(data[:size]), workers, EncryptOptions{BufferSize: 1024, Version: version}))
+				if err != nil {
+					t.Fatal(err)
+				}
+				decrypted, err := io.ReadAll(NewDecryptReader(privateKey, bytes.NewReader(encrypted)))
+				if err != nil {
+					t.Fatal(version, size, workers, err)
+				}
+				if !bytes.Equal(decrypted, data[:size]) {
+					t.Fatal(version, size, workers, "decrypted data does not match original")
+				}
+
+				encrypted, err = io.ReadAll(NewEncryptReaderWithVersion(publicKey, bytes.NewReader(data[:size]), 1024, version))
+				if err != nil {
+					t.Fatal(err)
+				}
+				decrypted, err = io.ReadAll(NewParallelDecryptReader(privateKey, bytes.NewReader(encrypted), workers))
+				if err != nil {
+					t.Fatal(version, size, workers, err)
+				}
+				if !bytes.Equal(decrypted, data[:size]) {
+					t.Fatal(version, size, workers, "decrypted data does not match original")
+				}
+			}
+		}
+	}
+
+	header, chunks := streamChunks(t, MagicBytesVersion4, publicKey, data, 1024)
+	truncated := bytes.NewBuffer(nil)
+	truncated.Write(header)
+	for _, chunk := range chunks[:len(chunks)-1] {
+		truncated.Write(chunk)
+	}
+	decryptor := NewParallelDecryptReader(privateKey, truncated, 4)
+	defer decryptor.Close()
+	if _, err := io.ReadAll(decryptor); err != ErrTruncated {
+		t.Fatal("expected ErrTruncated, got", err)
+	}
+
+	// Reading after Close fails instead of waiting for chunks forever.
+	for _, read := range []int{0, 10, 2048} {
+		encryptor := NewParallelEncryptReader([][]byte{publicKey}, bytes.NewReader(data), 1024, 4)
+		if _, err := io.ReadFull(encryptor, make([]byte, read)); err != nil {
+			t.Fatal(err)
+		}
+		encryptor.Close()
+		if _, err := encryptor.Read(make([]byte, 10)); err != io.ErrClosedPipe {
+			t.Fatal("expected io.ErrClosedPipe after reading", read, "bytes, got", err)
+		}
+	}
+}
+
+func benchmarkEncrypt(b *testing.B, version string) {
+	publicKey, _, err := GenerateKeys()
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, 1024*1024*4)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.Copy(io.Discard, NewEncryptReaderWithVersion(publicKey, bytes.NewReader(data), 1024*4, version)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecrypt(b *testing.B, version string) {
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, 1024*1024*4)
+	encrypted, err := io.ReadAll(NewEncryptReaderWithVersion(publicKey, bytes.NewReader(data), 1024*4, version))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.Copy(io.Discard, NewDecryptReader(privateKey, bytes.NewReader(encrypted))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParallelEncrypt(b *testing.B) {
+	publicKey, _, err := GenerateKeys()
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, 1024*1024*64)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.Copy(io.Discard, NewParallelEncryptReader([][]byte{publicKey}, bytes.NewReader(data), 1024*1024, 0)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncryptVersion1(b *testing.B) { benchmarkEncrypt(b, MagicBytesVersion1) }
+func BenchmarkEncryptVersion3(b *testing.B) { benchmarkEncrypt(b, MagicBytesVersion3) }
+func BenchmarkDecryptVersion1(b *testing.B) { benchmarkDecrypt(b, MagicBytesVersion1) }
+func BenchmarkDecryptVersion3(b *testing.B) { benchmarkDecrypt(b, MagicBytesVersion3) }
+
+func TestPrivateKeyFile(t *testing.T) {
+	_, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/key"
+	if err := SavePrivateKey(path, privateKey, []byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPrivateKey(path, []byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded, privateKey) {
+		t.Fatal("loaded private key does not match")
+	}
+	if _, err := LoadPrivateKey(path, []byte("hunter3")); err != ErrWrongPassphrase {
+		t.Fatal("expected ErrWrongPassphrase, got", err)
+	}
+
+	// Saving over an existing file, like when changing the passphrase, replaces it and its permissions.
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePrivateKey(path, privateKey, []byte("hunter3")); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := LoadPrivateKey(path, []byte("hunter3")); err != nil || !bytes.Equal(loaded, privateKey) {
+		t.Fatal("loaded private key does not match", err)
+	}
+	if stat, err := os.Stat(path); err != nil || stat.Mode().Perm() != 0600 {
+		t.Fatal("expected permissions 0600, got", stat.Mode().Perm(), err)
+	}
+	if entries, err := os.ReadDir(filepath.Dir(path)); err != nil || len(entries) != 1 {
+		t.Fatal("expected only the key file, got", entries, err)
+	}
+	// A failed save leaves the existing file alone.
+	if err := SavePrivateKey(path, privateKey[:31], []byte("hunter2")); err == nil {
+		t.Fatal("expected error for a short private key")
+	}
+	if _, err := LoadPrivateKey(path, []byte("hunter3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePrivateKey(path, privateKey, []byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving to a symlink replaces the file it points to, and a symlink to a missing file is refused.
+	linkDir := t.TempDir()
+	link := filepath.Join(linkDir, "link")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePrivateKey(link, privateKey, []byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("expected link to stay a symlink", err)
+	}
+	dangling := filepath.Join(linkDir, "dangling")
+	if err := os.Symlink(filepath.Join(linkDir, "missing"), dangling); err != nil {
+		t.Fatal(err)
+	}
+	if err := SavePrivateKey(dangling, privateKey, []byte("hunter2")); err == nil {
+		t.Fatal("expected error for a symlink to a missing file")
+	}
+	if info, err := os.Lstat(dangling); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("expected dangling to stay a symlink", err)
+	}
+	if entries, err := os.ReadDir(linkDir); err != nil || len(entries) != 2 {
+		t.Fatal("expected only the symlinks, got", entries, err)
+	}
+
+	// Lowering the kdf parameters must make decryption fail.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[8]--
+	if _, err := DecryptPrivateKey([]byte(base64.StdEncoding.EncodeToString(raw)), []byte("hunter2")); err == nil {
+		t.Fatal("expected error after changing kdf parameters")
+	}
+}
+
+func TestAuthenticatedEncryption(t *testing.T) {
+	senderPublicKey, senderPrivateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, privateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, _, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Single messages
+	encrypted, err := AuthenticatedEncrypt(senderPrivateKey, publicKey, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, sender, err := AuthenticatedDecrypt(privateKey, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != "hello" || !bytes.Equal(sender, senderPublicKey) {
+		t.Fatal("wrong message or sender")
+	}
+	// Replacing the sender's public key must make decryption fail.
+	copy(encrypted, otherPublicKey)
+	if _, _, err := AuthenticatedDecrypt(privateKey, encrypted); err == nil {
+		t.Fatal("expected error after replacing the sender")
+	}
+	// Keys of the wrong size must fail instead of panicking.
+	if _, err := AuthenticatedEncrypt(senderPrivateKey, publicKey[:31], []byte("hello")); err == nil {
+		t.Fatal("expected error for a short public key")
+	}
+	if _, err := PublicKeyEncrypt(publicKey[:31], []byte("hello")); err == nil {
+		t.Fatal("expected error for a short public key")
+	}
+	if _, err := PublicKeyDecrypt(privateKey[:31], encrypted); err == nil {
+		t.Fatal("expected error for a short private key")
+	}
+
+	// Streams
+	data := make([]byte, 1024*3)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	authenticated, err := io.ReadAll(NewEncryptReaderWithOptions([][]byte{publicKey}, bytes.NewReader(data), EncryptOptions{BufferSize: 1024, SenderPrivateKey: senderPrivateKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := io.ReadAll(NewEncryptReaderWithOptions([][]byte{publicKey}, bytes.NewReader(data), EncryptOptions{BufferSize: 1024}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		encrypted []byte
+		sender    []byte
+		err       error
+	}{
+		{"verified", authenticated, senderPublicKey, nil},
+		{"not verified", authenticated, nil, nil},
+		{"wrong sender", authenticated, otherPublicKey, ErrWrongSender},
+		{"anonymous", anonymous, senderPublicKey, ErrNotAuthenticated},
+	}
+	for _, test := range tests {
+		d := NewDecryptReaderWithOptions(privateKey, bytes.NewReader(test.encrypted), DecryptOptions{SenderPublicKey: test.sender})
+		decrypted, err := io.ReadAll(d)
+		if err != test.err {
+			t.Fatal(test.name, "expected error", test.err, "got", err)
+		}
+		if err != nil {
+			continue
+		}
+		if !bytes.Equal(decrypted, data) {
+			t.Fatal(test.name, "decrypted data does not match original")
+		}
+		if test.encrypted[len(MagicBytesVersion4)+4+2] == stanzaTypeSender && !bytes.Equal(d.(*StreamDecryption).Sender(), senderPublicKey) {
+			t.Fatal(test.name, "wrong sender")
+		}
+	}
+}
+
+// decryptFrom decrypts encrypted with privateKey, failing unless it was sent by senderPublicKey.
+func decryptFrom(privateKey []byte, senderPublicKey []byte, encrypted []byte) ([]byte, error) {
+	return io.ReadAll(NewDecryptReaderWithOptions(privateKey, bytes.NewReader(encrypted), DecryptOptions{SenderPublicKey: senderPublicKey}))
+}
+
+func TestAuthenticatedRecipientsCantForge(t *testing.T) {
+	senderPublicKey, senderPrivateKey, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyB, privateKeyB, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyC, privateKeyC, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := io.ReadAll(NewEncryptReaderWithOptions([][]byte{publicKeyB, publicKeyC}, strings.NewReader("hello"), EncryptOptions{BufferSize: 1024, SenderPrivateKey: senderPrivateKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, privateKey := range [][]byte{privateKeyB, privateKeyC} {
+		if decrypted, err := decryptFrom(privateKey, senderPublicKey, encrypted); err != nil || string(decrypted) != "hello" {
+			t.Fatal("expected hello, got", string(decrypted), err)
+		}
+	}
+
+	// B keeps the header, with the sender's stanza for C, and seals a different chunk with the file key from its own
+	// stanza. B can only make its own tag.
+	r := bytes.NewReader(encrypted[len(MagicBytesVersion4)+4+2:])
+	stanzaB, err := readStanza(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readStanza(r); err != nil {
+		t.Fatal(err)
+	}
+	header := encrypted[:len(encrypted)-r.Len()]
+	keys, _, err := AuthenticatedDecrypt(privateKeyB, stanzaB.body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := newPayloadCipher(keys[:32], header, version4KeyInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagKey, err := newSenderTagKey(keys[32:], header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := payload.seal(0, true, []byte("forged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := append(append([]byte{}, header...), sealed...)
+	forged = append(forged, senderTag(tagKey, 0, true, sealed)...)
+	forged = append(forged, make([]byte, senderTagSize)...)
+	// Like any recipient of an authenticated box, B can make messages that look authentic to itself.
+	if decrypted, err := decryptFrom(privateKeyB, senderPublicKey, forged); err != nil || string(decrypted) != "forged" {
+		t.Fatal("expected forged, got", string(decrypted), err)
+	}
+	if decrypted, err := decryptFrom(privateKeyC, senderPublicKey, forged); err != ErrCorrupt {
+		t.Fatal("expected ErrCorrupt, got", string(decrypted), err)
+	}
+}
+
+func TestSignReader(t *testing.T) {
+	publicKey, privateKey, err := GenerateSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, otherPrivateKey, err := GenerateSigningKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1024*64)
+	if _, err := crypto_ran.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	signature, err := SignReader(privateKey, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReader(publicKey, bytes.NewReader(data), signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyReader(otherPublicKey, bytes.NewReader(data), signature); err != ErrWrongSigner {
+		t.Fatal("expected ErrWrongSigner, got", err)
+	}
+	data[100]++
+	if err := VerifyReader(publicKey, bytes.NewReader(data), signature); err != ErrInvalidSignature {
+		t.Fatal("expected ErrInvalidSignature, got", err)
+	}
+
+	// A signature made by another key, but claiming to be from publicKey, must not verify.
+	otherSignature, err := SignReader(otherPrivateKey, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(otherSignature)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(raw[len(MagicBytesSignature):], publicKey)
+	if err := VerifyReader(publicKey, bytes.NewReader(data), []byte(base64.StdEncoding.EncodeToString(raw))); err != ErrInvalidSignature {
+		t.Fatal("expected ErrInvalidSignature, got", err)
+	}
+}
+
+func TestKeysFromSeed(t *testing.T) {
+	vectors := []struct {
+		seed, privateKey, publicKey string
+	}{
+		{"00000000000000000000000000000000", "fa6356226844ed85162907f48926d1820b596794c34090904592473606e7d37c", "3f3bb35ba9af34ab57395898b388f8ea11ae51f8db20fbaf7fbda94ca3521b78"},
+		{"000102030405060708090a0b0c0d0e0f", "9606632bb7d60efca0bcb818f5717f0105f5264b69f2b75adb3c5506bcdded63", "c72a60b709483c5e5a92317d47768be27e6b481374938a5d43b8c8da3b3aa744"},
+		{"ffffffffffffffffffffffffffffffff", "2a8eeb3939ca6815f745ece97278081a0357bbf57fdb6395f1b9e316296736af", "88844241cc29503d92e7e0c65e4492e2e0c3d186b733703e34685d7d0813bf16"},
+	}
+	for _, v := range vectors {
+		seed, _ := hex.DecodeString(v.seed)
+		publicKey, privateKey, err := KeysFromSeed(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(privateKey) != v.privateKey || hex.EncodeToString(publicKey) != v.publicKey {
+			t.Fatal("unexpected keys for seed", v.seed)
+		}
+	}
+
+	seed, err := GenerateSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, privateKey, err := KeysFromSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte("hello")
+	encrypted, err := PublicKeyEncrypt(publicKey, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := PublicKeyDecrypt(privateKey, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Fatal("decrypted data does not match original")
+	}
+	if _, _, err := KeysFromSeed(seed[1:]); err == nil {
+		t.Fatal("expected error for short seed")
+	}
+}
@@ -0,0 +1,75 @@
+package encryption
+
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"io"
+	"io/fs"
+	"time"
+)
+
+const metadataKeyInfo = "OwO4 metadata key"
+
+// Metadata describes the original file of an encrypted stream. It is stored in the header, encrypted with the file key,
+// so only recipients can read it. Every field is optional.
+type Metadata struct {
+	// Original file name, without any directories.
+	Name string `json:"name,omitempty"`
+	// Permission bits of the original file.
+	Mode fs.FileMode `json:"mode,omitempty"`
+	// Modification time of the original file.
+	ModTime time.Time `json:"modTime"`
+	// Size of the original file in bytes.
+	Size int64 `json:"size,omitempty"`
+	// MIME type of the original file, such as "text/plain; charset=utf-8".
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// sealMetadata encrypts m for the body of a metadata stanza. The key is derived from the file key with the header before
+// the metadata stanza as the salt, so the metadata can't be moved to another stream. The key is only used once, so the
+// nonce is always that of a single final chunk.
+func sealMetadata(fileKey []byte, header []byte, m *Metadata) ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)+chacha20poly1305.Overhead > 0xffff {
+		return nil, errors.New("metadata is too large")
+	}
+	c, err := newPayloadCipher(fileKey, header, metadataKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return c.seal(0, true, data)
+}
+
+// openMetadata decrypts the body of a metadata stanza.
+func openMetadata(fileKey []byte, header []byte, body []byte) (*Metadata, error) {
+	c, err := newPayloadCipher(fileKey, header, metadataKeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.open(0, true, body)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.New("invalid metadata: " + err.Error())
+	}
+	return m, nil
+}
+
+// ReadMetadata reads the header of an encrypted stream from r, and returns its metadata, or nil if it has none. Only
+// the header is read, so none of the data is decrypted.
+func ReadMetadata(privateKey []byte, r io.Reader) (*Metadata, error) {
+	d := &StreamDecryption{DataProvider: r, privateKey: privateKey}
+	if err := d.readKeys(); err != nil {
+		return nil, err
+	}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d.metadata, nil
+}
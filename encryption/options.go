@@ -0,0 +1,36 @@
+package encryption
+
+// EncryptOptions are the settings used to encrypt a stream. The zero value uses the defaults.
+type EncryptOptions struct {
+	// Size of the chunks the data is split into. If 0, 16kb is used.
+	BufferSize int
+	// Format version, such as MagicBytesVersion1. If empty, DefaultVersion is used. You only need this to create files
+	// for older versions of this program.
+	Version string
+	// If set, the stream is authenticated with this private key, so recipients can verify who sent it. Requires
+	// MagicBytesVersion4.
+	SenderPrivateKey []byte
+	// If true, the key ID of every recipient is written to the header, so decryption with the wrong private key fails
+	// with an error naming the fingerprints the stream is for. This reveals who the recipients are to anyone with their
+	// public keys. Requires MagicBytesVersion4.
+	IncludeKeyIds bool
+	// If set, the metadata is encrypted with the file key and written to the header, where recipients can read it with
+	// ReadMetadata without decrypting the data. Requires MagicBytesVersion4.
+	Metadata *Metadata
+}
+
+func (o EncryptOptions) withDefaults() EncryptOptions {
+	if o.BufferSize == 0 {
+		o.BufferSize = defaultBufferSize
+	}
+	if o.Version == "" {
+		o.Version = DefaultVersion
+	}
+	return o
+}
+
+// DecryptOptions are the settings used to decrypt a stream. The zero value uses the defaults.
+type DecryptOptions struct {
+	// If set, decryption fails unless the stream was authenticated by the private key belonging to this public key.
+	SenderPublicKey []byte
+}
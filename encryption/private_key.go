@@ -0,0 +1,140 @@
+package encryption
+
+import (
+	crypto_ran "crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MagicBytesPrivateKey starts every encrypted private key.
+const MagicBytesPrivateKey string = "OwOK"
+
+const (
+	keyFileKdfArgon2id byte = 1
+
+	// Argon2id parameters for new key files, from the second recommended option of RFC 9106.
+	keyFileTime    uint32 = 3
+	keyFileMemory  uint32 = 64 * 1024 // 64MB
+	keyFileThreads uint8  = 4
+
+	// Limits for reading key files, so a corrupt file can't use unlimited time or memory.
+	maxKeyFileTime   uint32 = 64
+	maxKeyFileMemory uint32 = 4 * 1024 * 1024 // 4GB
+
+	keyFileSaltSize = 16
+	// Magic bytes, kdf, time, memory, threads, salt and nonce.
+	keyFileHeaderSize = 4 + 1 + 4 + 4 + 1 + keyFileSaltSize + chacha20poly1305.NonceSizeX
+)
+
+// ErrWrongPassphrase is returned when an encrypted private key can't be decrypted with the passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupt private key")
+
+// EncryptPrivateKey encrypts privateKey with a key derived from passphrase using Argon2id, and returns it as base64
+// text suitable for saving to a file.
+func EncryptPrivateKey(privateKey []byte, passphrase []byte) ([]byte, error) {
+	if len(privateKey) != 32 {
+		return nil, errors.New("invalid private key size")
+	}
+	header := make([]byte, keyFileHeaderSize)
+	copy(header, MagicBytesPrivateKey)
+	header[4] = keyFileKdfArgon2id
+	binary.BigEndian.PutUint32(header[5:], keyFileTime)
+	binary.BigEndian.PutUint32(header[9:], keyFileMemory)
+	header[13] = keyFileThreads
+	if _, err := crypto_ran.Read(header[14:]); err != nil {
+		return nil, err
+	}
+	salt := header[14 : 14+keyFileSaltSize]
+	nonce := header[14+keyFileSaltSize:]
+	aead, err := chacha20poly1305.NewX(argon2.IDKey(passphrase, salt, keyFileTime, keyFileMemory, keyFileThreads, chacha20poly1305.KeySize))
+	if err != nil {
+		return nil, err
+	}
+	// The header is authenticated, so the parameters can't be changed.
+	data := aead.Seal(header, nonce, privateKey, header)
+	return []byte(base64.StdEncoding.EncodeToString(data) + "\n"), nil
+}
+
+// DecryptPrivateKey decrypts a private key created by EncryptPrivateKey.
+func DecryptPrivateKey(encryptedKey []byte, passphrase []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encryptedKey)))
+	if err != nil {
+		return nil, errors.New("invalid private key file: " + err.Error())
+	}
+	if len(data) < keyFileHeaderSize || string(data[:4]) != MagicBytesPrivateKey {
+		return nil, errors.New("invalid private key file")
+	}
+	if data[4] != keyFileKdfArgon2id {
+		return nil, errors.New("unsupported private key file kdf")
+	}
+	iterations := binary.BigEndian.Uint32(data[5:])
+	memory := binary.BigEndian.Uint32(data[9:])
+	threads := data[13]
+	if iterations < 1 || iterations > maxKeyFileTime || memory < 8*uint32(threads) || memory > maxKeyFileMemory || threads < 1 {
+		return nil, errors.New("invalid private key file kdf parameters")
+	}
+	header := data[:keyFileHeaderSize]
+	salt := header[14 : 14+keyFileSaltSize]
+	nonce := header[14+keyFileSaltSize:]
+	aead, err := chacha20poly1305.NewX(argon2.IDKey(passphrase, salt, iterations, memory, threads, chacha20poly1305.KeySize))
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := aead.Open(nil, nonce, data[keyFileHeaderSize:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return privateKey, nil
+}
+
+// SavePrivateKey encrypts privateKey with passphrase and writes it to path. The file is only readable by the current
+// user. It is written to a temporary file that replaces path once it is complete, so an existing key is never lost if
+// saving fails.
+func SavePrivateKey(path string, privateKey []byte, passphrase []byte) error {
+	data, err := EncryptPrivateKey(privateKey, passphrase)
+	if err != nil {
+		return err
+	}
+	// Replace the file a symlink points to, not the symlink.
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if info, lstatErr := os.Lstat(path); lstatErr == nil && info.Mode()&os.ModeSymlink != 0 {
+		// Renaming over a symlink that can't be followed, such as one to a missing file, would replace the symlink.
+		return errors.New("cannot save private key to symlink " + path + ": " + err.Error())
+	}
+	// Temporary files are created only readable by the current user.
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// LoadPrivateKey reads a private key saved by SavePrivateKey and decrypts it with passphrase.
+func LoadPrivateKey(path string, passphrase []byte) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptPrivateKey(data, passphrase)
+}
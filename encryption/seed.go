@@ -0,0 +1,43 @@
+package encryption
+
+import (
+	crypto_ran "crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"strconv"
+)
+
+// SeedSize is the size of the seeds used by GenerateSeed and KeysFromSeed.
+const SeedSize = 16
+
+// Info used to derive private keys from seeds. Changing it changes the keys of every seed.
+const seedKeyInfo = "OwO seed private key"
+
+// GenerateSeed returns a random seed for KeysFromSeed.
+func GenerateSeed() ([]byte, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := crypto_ran.Read(seed); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// KeysFromSeed deterministically derives a key pair from seed, returning the public and private key like
+// GenerateKeys. The private key is derived with HKDF-SHA256, so the same seed always gives the same keys and the seed
+// can be backed up in their place.
+func KeysFromSeed(seed []byte) ([]byte, []byte, error) {
+	if len(seed) != SeedSize {
+		return nil, nil, errors.New("invalid seed size: " + strconv.Itoa(len(seed)))
+	}
+	privateKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, seed, nil, []byte(seedKeyInfo)), privateKey); err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := GetPublicKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publicKey, privateKey, nil
+}
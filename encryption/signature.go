@@ -0,0 +1,112 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	crypto_ran "crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// MagicBytesSignature starts every detached signature.
+const MagicBytesSignature string = "OwOS"
+
+// Context of every signature, so they can't be confused with Ed25519ph signatures made by other programs.
+const signatureContext = "OwO detached signature"
+
+var (
+	// ErrInvalidSignature is returned when a signature does not match the data.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrWrongSigner is returned when a signature was made by a different key than expected.
+	ErrWrongSigner = errors.New("signature was made by a different key")
+)
+
+// GenerateSigningKeys generates an Ed25519 key pair for SignReader. The private key is the 32 byte seed.
+func GenerateSigningKeys() ([]byte, []byte, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(crypto_ran.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publicKey, privateKey.Seed(), nil
+}
+
+// GetSigningPublicKey returns the public key belonging to a private key from GenerateSigningKeys.
+func GetSigningPublicKey(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, errors.New("invalid signing key size")
+	}
+	return ed25519.NewKeyFromSeed(privateKey).Public().(ed25519.PublicKey), nil
+}
+
+// hashReader returns the SHA-512 hash of everything in data.
+func hashReader(data io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SignReader signs everything in data with privateKey and returns a detached signature as base64 text, suitable for
+// saving to a file. data is hashed with SHA-512 as it is read and signed with Ed25519ph, so it can be any size.
+func SignReader(privateKey []byte, data io.Reader) ([]byte, error) {
+	if len(privateKey) != ed25519.SeedSize {
+		return nil, errors.New("invalid signing key size")
+	}
+	key := ed25519.NewKeyFromSeed(privateKey)
+	digest, err := hashReader(data)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := key.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512, Context: signatureContext})
+	if err != nil {
+		return nil, err
+	}
+	encoded := append([]byte(MagicBytesSignature), key.Public().(ed25519.PublicKey)...)
+	encoded = append(encoded, signature...)
+	return []byte(base64.StdEncoding.EncodeToString(encoded) + "\n"), nil
+}
+
+// SignaturePublicKey returns the public key that made a signature from SignReader, without verifying it.
+func SignaturePublicKey(signature []byte) ([]byte, error) {
+	publicKey, _, err := parseSignature(signature)
+	return publicKey, err
+}
+
+func parseSignature(signature []byte) ([]byte, []byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return nil, nil, errors.New("invalid signature file: " + err.Error())
+	}
+	if len(data) != len(MagicBytesSignature)+ed25519.PublicKeySize+ed25519.SignatureSize || string(data[:len(MagicBytesSignature)]) != MagicBytesSignature {
+		return nil, nil, errors.New("invalid signature file")
+	}
+	data = data[len(MagicBytesSignature):]
+	return data[:ed25519.PublicKeySize], data[ed25519.PublicKeySize:], nil
+}
+
+// VerifyReader checks that signature, returned by SignReader, was made by publicKey for everything in data.
+func VerifyReader(publicKey []byte, data io.Reader, signature []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid signing public key size")
+	}
+	signer, sig, err := parseSignature(signature)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(signer, publicKey) {
+		return ErrWrongSigner
+	}
+	digest, err := hashReader(data)
+	if err != nil {
+		return err
+	}
+	if err := ed25519.VerifyWithOptions(publicKey, digest, sig, &ed25519.Options{Hash: crypto.SHA512, Context: signatureContext}); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
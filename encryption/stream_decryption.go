@@ -1,10 +1,10 @@
 package encryption
 
 import (
+	"bytes"
 	"crypto/ecdh"
 	"encoding/binary"
 	"errors"
-	"golang.org/x/crypto/nacl/box"
 	"io"
 	"strconv"
 )
@@ -23,6 +23,16 @@ type StreamDecryption struct {
 	privateKey    []byte
 	publicKey     []byte
 	didReadHeader bool
+	options       DecryptOptions
+	// Public key of the sender, if the stream is authenticated.
+	sender []byte
+	// Metadata from the header, if the stream has any.
+	metadata *Metadata
+	opener   chunkOpener
+	// Index of the next chunk to be decrypted.
+	index uint64
+	// True once the final chunk has been decrypted.
+	done bool
 }
 
 func readAtLeastOrEof(r io.Reader, dest []byte) (int, error) {
@@ -44,34 +54,80 @@ func readAtLeastOrEof(r io.Reader, dest []byte) (int, error) {
 
 func (s *StreamDecryption) readHeader() error {
 	// 4 bytes for buffer size
-	s.buff = make([]byte, 4+len(MagicBytesVersion1))
-	if _, err := readAtLeastOrEof(s.DataProvider, s.buff); err != nil {
+	header := make([]byte, 4+len(MagicBytesVersion1))
+	n, err := readAtLeastOrEof(s.DataProvider, header)
+	if err != nil {
 		return errors.New("error reading header: " + err.Error())
 	}
-	// We only support MagicBytesVersion1. New versions should add header support here.
-	if string(s.buff[:len(MagicBytesVersion1)]) != MagicBytesVersion1 {
+	if n < len(header) {
 		return errors.New("invalid encryption header")
 	}
 	// Determine buff size.
-	s.bufferSize = int(binary.BigEndian.Uint32(s.buff[len(MagicBytesVersion1):]))
-	// Right now, up to 128MB is recommended, but we'll allow up to 1GB.
-	if s.bufferSize < 1 || s.bufferSize > 1024*1024*1024 {
+	s.bufferSize = int(binary.BigEndian.Uint32(header[len(MagicBytesVersion1):]))
+	if s.bufferSize < 1 || s.bufferSize > maxBufferSize {
 		return errors.New("invalid decryption buffer size: " + strconv.Itoa(s.bufferSize))
 	}
-	// Reset buff since there's nothing left to read.
-	s.buff = nil
+	// New versions should add header support here.
+	switch string(header[:len(MagicBytesVersion1)]) {
+	case MagicBytesVersion1:
+		s.opener = &version1Opener{publicKey: s.publicKey, privateKey: s.privateKey}
+	case MagicBytesVersion2:
+		streamId := make([]byte, version2StreamIdSize)
+		if _, err := io.ReadFull(s.DataProvider, streamId); err != nil {
+			return errors.New("error reading header: " + err.Error())
+		}
+		s.opener = &version2Opener{publicKey: s.publicKey, privateKey: s.privateKey, streamId: streamId}
+	case MagicBytesVersion3:
+		if s.opener, err = readVersion3Header(s.DataProvider, header, s.publicKey, s.privateKey); err != nil {
+			return err
+		}
+	case MagicBytesVersion4:
+		v4, err := readVersion4Header(s.DataProvider, header, s.publicKey, s.privateKey)
+		if err != nil {
+			return err
+		}
+		s.opener, s.sender, s.metadata = v4.opener, v4.sender, v4.metadata
+	default:
+		return errors.New("invalid encryption header")
+	}
+	if s.options.SenderPublicKey != nil {
+		if s.sender == nil {
+			return ErrNotAuthenticated
+		}
+		if !bytes.Equal(s.sender, s.options.SenderPublicKey) {
+			return ErrWrongSender
+		}
+	}
+	return nil
+}
+
+// Sender returns the public key of the sender if the stream is authenticated, or nil if it is anonymous. It is only
+// set after the first call to Read.
+func (s *StreamDecryption) Sender() []byte {
+	return s.sender
+}
+
+// Metadata returns the metadata of the stream, or nil if it has none. It is only set after the first call to Read.
+func (s *StreamDecryption) Metadata() *Metadata {
+	return s.metadata
+}
+
+// readKeys gets the public key from the private key.
+func (s *StreamDecryption) readKeys() error {
+	keyData, err := ecdh.X25519().NewPrivateKey(s.privateKey)
+	if err != nil {
+		return err
+	}
+	s.publicKey = keyData.PublicKey().Bytes()
 	return nil
 }
 
 func (s *StreamDecryption) Read(p []byte) (int, error) {
 	// Read public key
 	if s.publicKey == nil {
-		// get public key from private key
-		keyData, err := ecdh.X25519().NewPrivateKey(s.privateKey)
-		if err != nil {
+		if err := s.readKeys(); err != nil {
 			return 0, err
 		}
-		s.publicKey = keyData.PublicKey().Bytes()
 	}
 
 	// Read header
@@ -87,36 +143,56 @@ func (s *StreamDecryption) Read(p []byte) (int, error) {
 		s.i += n
 		return n, nil
 	}
+	if s.done {
+		return 0, io.EOF
+	}
 
 	// We need to read and decrypt data. Reset i.
 	s.i = 0
 	if s.encryptedBuff == nil {
-		s.encryptedBuff = make([]byte, s.bufferSize+box.AnonymousOverhead)
+		s.encryptedBuff = make([]byte, s.bufferSize+s.opener.overhead())
 	}
 	toDecryptLen, err := readAtLeastOrEof(s.DataProvider, s.encryptedBuff)
 	if err != nil {
 		return 0, err
 	}
 	if toDecryptLen == 0 {
+		if s.opener.terminated() {
+			return 0, ErrTruncated
+		}
 		return 0, io.EOF
 	}
-	// Read size can be smaller than bufferSize if we're on the last chunk.
-	if toDecryptLen < s.bufferSize {
-		s.encryptedBuff = s.encryptedBuff[0:toDecryptLen]
-	}
-	s.buff, err = DecryptWithPublicKey(s.publicKey, s.privateKey, s.encryptedBuff)
+	// Read size can be smaller than the chunk size if we're on the last chunk. Anything appended after the last chunk is
+	// read together with it, so it fails to decrypt.
+	last := toDecryptLen < len(s.encryptedBuff)
+	s.buff, err = s.opener.open(s.index, last, s.encryptedBuff[:toDecryptLen])
 	if err != nil {
 		return 0, err
 	}
+	s.index++
+	if last {
+		s.done = true
+		s.encryptedBuff = nil
+	}
 	n := copy(p, s.buff[s.i:])
 	s.i += n
+	if n == 0 && s.done {
+		// Empty final chunk.
+		return 0, io.EOF
+	}
 	return n, nil
 }
 
 func NewDecryptReader(privateKey []byte, data io.Reader) io.Reader {
+	return NewDecryptReaderWithOptions(privateKey, data, DecryptOptions{})
+}
+
+// NewDecryptReaderWithOptions decrypts data using privateKey and options.
+func NewDecryptReaderWithOptions(privateKey []byte, data io.Reader, options DecryptOptions) io.Reader {
 	s := &StreamDecryption{
 		DataProvider: data,
 		privateKey:   privateKey,
+		options:      options,
 	}
 	return s
 }
@@ -1,7 +1,6 @@
 package encryption
 
 import (
-	"encoding/binary"
 	"io"
 )
 
@@ -11,17 +10,25 @@ type StreamEncryption struct {
 	i               int
 	buff            []byte
 	unencryptedBuff []byte
-	publicKey       []byte
+	publicKeys      [][]byte
 
 	didSendHeader bool
-	bufferSize    int
+	options       EncryptOptions
+	sealer        chunkSealer
+	// Index of the next chunk to be encrypted.
+	index uint64
+	// True once the final chunk has been encrypted.
+	done bool
 }
 
 func (s *StreamEncryption) Read(p []byte) (int, error) {
 	if !s.didSendHeader {
-		s.buff = make([]byte, 4+len(MagicBytesVersion1))
-		copy(s.buff, MagicBytesVersion1)
-		binary.BigEndian.PutUint32(s.buff[len(MagicBytesVersion1):], uint32(s.bufferSize))
+		sealer, err := newChunkSealer(s.publicKeys, s.options)
+		if err != nil {
+			return 0, err
+		}
+		s.sealer = sealer
+		s.buff = sealer.header()
 		s.didSendHeader = true
 	}
 	if len(s.buff) != 0 && len(s.buff) > s.i {
@@ -29,45 +36,64 @@ func (s *StreamEncryption) Read(p []byte) (int, error) {
 		s.i += n
 		return n, nil
 	}
+	if s.done {
+		return 0, io.EOF
+	}
 
 	s.i = 0
 	if s.unencryptedBuff == nil {
-		s.unencryptedBuff = make([]byte, s.bufferSize)
+		s.unencryptedBuff = make([]byte, s.options.BufferSize)
 	}
 	toEncryptLen, err := readAtLeastOrEof(s.DataProvider, s.unencryptedBuff)
 	if err != nil {
 		return 0, err
 	}
-	if toEncryptLen == 0 {
+	// A chunk smaller than the buffer size is always the last one. If the data ends exactly on a chunk boundary,
+	// formats that mark their final chunk send an empty one.
+	last := toEncryptLen < s.options.BufferSize
+	if toEncryptLen == 0 && !s.sealer.terminated() {
 		return 0, io.EOF
 	}
-	if toEncryptLen < s.bufferSize {
-		s.unencryptedBuff = s.unencryptedBuff[0:toEncryptLen]
-	}
-	s.buff, err = PublicKeyEncrypt(s.publicKey, s.unencryptedBuff[:toEncryptLen])
+	s.buff, err = s.sealer.seal(s.index, last, s.unencryptedBuff[:toEncryptLen])
 	if err != nil {
 		return 0, err
 	}
-	s.unencryptedBuff = nil
+	s.index++
+	if last {
+		s.done = true
+		s.unencryptedBuff = nil
+	}
 	n := copy(p, s.buff[s.i:])
 	s.i += n
 	return n, nil
 }
 
 func NewEncryptReader(publicKey []byte, data io.Reader) io.Reader {
-	s := &StreamEncryption{
-		DataProvider: data,
-		publicKey:    publicKey,
-		bufferSize:   defaultBufferSize,
-	}
-	return s
+	return NewEncryptReaderWithOptions([][]byte{publicKey}, data, EncryptOptions{})
 }
 
 func NewEncryptReaderWithBufferSize(publicKey []byte, data io.Reader, bufferSize int) io.Reader {
+	return NewEncryptReaderWithOptions([][]byte{publicKey}, data, EncryptOptions{BufferSize: bufferSize})
+}
+
+// NewEncryptReaderWithVersion encrypts data using the format given by version, such as MagicBytesVersion1. You only
+// need this to create files for older versions of this program - NewEncryptReaderWithBufferSize uses DefaultVersion.
+func NewEncryptReaderWithVersion(publicKey []byte, data io.Reader, bufferSize int, version string) io.Reader {
+	return NewEncryptReaderWithOptions([][]byte{publicKey}, data, EncryptOptions{BufferSize: bufferSize, Version: version})
+}
+
+// NewMultiEncryptReader encrypts data for several recipients. Any one of the private keys matching publicKeys can
+// decrypt it with NewDecryptReader.
+func NewMultiEncryptReader(publicKeys [][]byte, data io.Reader, bufferSize int) io.Reader {
+	return NewEncryptReaderWithOptions(publicKeys, data, EncryptOptions{BufferSize: bufferSize, Version: MagicBytesVersion4})
+}
+
+// NewEncryptReaderWithOptions encrypts data for every key in publicKeys, using options.
+func NewEncryptReaderWithOptions(publicKeys [][]byte, data io.Reader, options EncryptOptions) io.Reader {
 	s := &StreamEncryption{
 		DataProvider: data,
-		publicKey:    publicKey,
-		bufferSize:   bufferSize,
+		publicKeys:   publicKeys,
+		options:      options.withDefaults(),
 	}
 	return s
 }
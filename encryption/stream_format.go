@@ -0,0 +1,305 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	crypto_ran "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/box"
+	"io"
+	"strconv"
+)
+
+var (
+	// ErrTruncated is returned when a stream ends before its final chunk.
+	ErrTruncated = errors.New("encrypted stream is truncated")
+	// ErrChunkOrder is returned when a chunk is out of order, duplicated, or belongs to another stream.
+	ErrChunkOrder = errors.New("encrypted chunk is out of order or belongs to another stream")
+	// ErrCorrupt is returned when a chunk fails to decrypt because it was changed, moved or cut short.
+	ErrCorrupt = errors.New("encrypted stream is corrupt")
+)
+
+// chunkSealer encrypts the chunks of a single stream.
+type chunkSealer interface {
+	// header returns the bytes written before the first chunk.
+	header() []byte
+	// seal encrypts the chunk at position index. last is true for the final chunk of the stream.
+	seal(index uint64, last bool, plainText []byte) ([]byte, error)
+	// terminated returns true if the format always ends with a chunk marked as last, even if it is empty.
+	terminated() bool
+}
+
+// chunkOpener decrypts the chunks of a single stream.
+type chunkOpener interface {
+	// open decrypts the chunk at position index. last is true for the final chunk of the stream.
+	open(index uint64, last bool, encryptedData []byte) ([]byte, error)
+	// overhead returns the number of bytes each chunk grows by when encrypted.
+	overhead() int
+	// terminated returns true if the format always ends with a chunk marked as last, even if it is empty.
+	terminated() bool
+}
+
+func newChunkSealer(publicKeys [][]byte, options EncryptOptions) (chunkSealer, error) {
+	version, bufferSize := options.Version, options.BufferSize
+	if bufferSize < 1 || bufferSize > maxBufferSize {
+		return nil, errors.New("invalid encryption buffer size: " + strconv.Itoa(bufferSize))
+	}
+	if version == MagicBytesVersion4 {
+		return newVersion4Sealer(publicKeys, options)
+	}
+	// Older versions only support a single anonymous recipient.
+	if len(publicKeys) != 1 {
+		return nil, errors.New(version + " does not support multiple recipients")
+	}
+	if options.SenderPrivateKey != nil {
+		return nil, errors.New(version + " does not support authentication")
+	}
+	if options.IncludeKeyIds {
+		return nil, errors.New(version + " does not support key IDs")
+	}
+	if options.Metadata != nil {
+		return nil, errors.New(version + " does not support metadata")
+	}
+	publicKey := publicKeys[0]
+	switch version {
+	case MagicBytesVersion1:
+		return &version1Sealer{publicKey: publicKey, bufferSize: bufferSize}, nil
+	case MagicBytesVersion2:
+		streamId := make([]byte, version2StreamIdSize)
+		if _, err := crypto_ran.Read(streamId); err != nil {
+			return nil, err
+		}
+		return &version2Sealer{publicKey: publicKey, bufferSize: bufferSize, streamId: streamId}, nil
+	case MagicBytesVersion3:
+		return newVersion3Sealer(publicKey, bufferSize)
+	}
+	return nil, errors.New("unsupported encryption version: " + version)
+}
+
+// baseHeader returns the magic bytes followed by the chunk size, which every version starts with.
+func baseHeader(version string, bufferSize int) []byte {
+	header := make([]byte, len(version)+4)
+	copy(header, version)
+	binary.BigEndian.PutUint32(header[len(version):], uint32(bufferSize))
+	return header
+}
+
+// version1Sealer seals each chunk as an independent anonymous box. Chunks are not bound to their position.
+type version1Sealer struct {
+	publicKey  []byte
+	bufferSize int
+}
+
+func (v *version1Sealer) header() []byte {
+	return baseHeader(MagicBytesVersion1, v.bufferSize)
+}
+
+func (v *version1Sealer) seal(_ uint64, _ bool, plainText []byte) ([]byte, error) {
+	return PublicKeyEncrypt(v.publicKey, plainText)
+}
+
+func (v *version1Sealer) terminated() bool {
+	return false
+}
+
+type version1Opener struct {
+	publicKey  []byte
+	privateKey []byte
+}
+
+func (v *version1Opener) open(_ uint64, _ bool, encryptedData []byte) ([]byte, error) {
+	data, err := DecryptWithPublicKey(v.publicKey, v.privateKey, encryptedData)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+func (v *version1Opener) overhead() int {
+	return box.AnonymousOverhead
+}
+
+func (v *version1Opener) terminated() bool {
+	return false
+}
+
+const (
+	// Random identifier of a version 2 stream, written in the header and at the start of every chunk.
+	version2StreamIdSize = 16
+	// Stream id, chunk index and last chunk flag.
+	version2PrefixSize = version2StreamIdSize + 8 + 1
+)
+
+// version2Sealer seals each chunk as an anonymous box, prefixing the plain text with the stream id, the chunk index and
+// a flag marking the final chunk. This binds every chunk to its position in the stream.
+type version2Sealer struct {
+	publicKey  []byte
+	bufferSize int
+	streamId   []byte
+}
+
+func version2Prefix(streamId []byte, index uint64, last bool) []byte {
+	prefix := make([]byte, version2PrefixSize)
+	copy(prefix, streamId)
+	binary.BigEndian.PutUint64(prefix[version2StreamIdSize:], index)
+	if last {
+		prefix[version2PrefixSize-1] = 1
+	}
+	return prefix
+}
+
+func (v *version2Sealer) header() []byte {
+	return append(baseHeader(MagicBytesVersion2, v.bufferSize), v.streamId...)
+}
+
+func (v *version2Sealer) seal(index uint64, last bool, plainText []byte) ([]byte, error) {
+	data := append(version2Prefix(v.streamId, index, last), plainText...)
+	return PublicKeyEncrypt(v.publicKey, data)
+}
+
+func (v *version2Sealer) terminated() bool {
+	return true
+}
+
+type version2Opener struct {
+	publicKey  []byte
+	privateKey []byte
+	streamId   []byte
+}
+
+func (v *version2Opener) open(index uint64, last bool, encryptedData []byte) ([]byte, error) {
+	data, err := DecryptWithPublicKey(v.publicKey, v.privateKey, encryptedData)
+	if err != nil || len(data) < version2PrefixSize {
+		return nil, ErrCorrupt
+	}
+	if !bytes.Equal(data[:version2PrefixSize], version2Prefix(v.streamId, index, last)) {
+		return nil, ErrChunkOrder
+	}
+	return data[version2PrefixSize:], nil
+}
+
+func (v *version2Opener) overhead() int {
+	return box.AnonymousOverhead + version2PrefixSize
+}
+
+func (v *version2Opener) terminated() bool {
+	return true
+}
+
+const version3KeyInfo = "OwO3 payload key"
+
+// payloadCipher seals chunks with ChaCha20-Poly1305 under a single key. The nonce is the chunk index followed by a
+// flag marking the final chunk, so chunks are bound to their position in the stream.
+type payloadCipher struct {
+	aead cipher.AEAD
+}
+
+// newPayloadCipher derives the payload key from secret. salt should contain the whole header, so that changing any
+// part of it makes every chunk fail to decrypt.
+func newPayloadCipher(secret []byte, salt []byte, info string) (*payloadCipher, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadCipher{aead: aead}, nil
+}
+
+func payloadNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[chacha20poly1305.NonceSize-9:], index)
+	if last {
+		nonce[chacha20poly1305.NonceSize-1] = 1
+	}
+	return nonce
+}
+
+func (c *payloadCipher) seal(index uint64, last bool, plainText []byte) ([]byte, error) {
+	return c.aead.Seal(nil, payloadNonce(index, last), plainText, nil), nil
+}
+
+func (c *payloadCipher) open(index uint64, last bool, encryptedData []byte) ([]byte, error) {
+	data, err := c.aead.Open(nil, payloadNonce(index, last), encryptedData, nil)
+	if err != nil {
+		// Chunks that were moved, or a final chunk that was removed, fail authentication like any other change.
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+func (c *payloadCipher) overhead() int {
+	return c.aead.Overhead()
+}
+
+func (c *payloadCipher) terminated() bool {
+	return true
+}
+
+// version3Sealer performs a single X25519 exchange between an ephemeral key and the recipient, then seals all chunks
+// with a payloadCipher.
+type version3Sealer struct {
+	*payloadCipher
+	headerData []byte
+}
+
+// version3Secret performs the key exchange for a version 3 stream and returns the shared secret and the salt for the
+// payload key.
+func version3Secret(privateKey *ecdh.PrivateKey, peerPublicKey []byte, header []byte, recipientPublicKey []byte) ([]byte, []byte, error) {
+	peer, err := ecdh.X25519().NewPublicKey(peerPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := privateKey.ECDH(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	salt := append(append([]byte{}, header...), recipientPublicKey...)
+	return secret, salt, nil
+}
+
+func newVersion3Sealer(publicKey []byte, bufferSize int) (*version3Sealer, error) {
+	ephemeralKey, err := ecdh.X25519().GenerateKey(crypto_ran.Reader)
+	if err != nil {
+		return nil, err
+	}
+	header := append(baseHeader(MagicBytesVersion3, bufferSize), ephemeralKey.PublicKey().Bytes()...)
+	secret, salt, err := version3Secret(ephemeralKey, publicKey, header, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := newPayloadCipher(secret, salt, version3KeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &version3Sealer{payloadCipher: payload, headerData: header}, nil
+}
+
+func (v *version3Sealer) header() []byte {
+	return v.headerData
+}
+
+// readVersion3Header reads the rest of a version 3 header after the chunk size. header contains the bytes read so far.
+func readVersion3Header(r io.Reader, header []byte, publicKey []byte, privateKey []byte) (chunkOpener, error) {
+	ephemeralPublicKey := make([]byte, 32)
+	if _, err := io.ReadFull(r, ephemeralPublicKey); err != nil {
+		return nil, errors.New("error reading header: " + err.Error())
+	}
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	header = append(append([]byte{}, header...), ephemeralPublicKey...)
+	secret, salt, err := version3Secret(key, ephemeralPublicKey, header, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return newPayloadCipher(secret, salt, version3KeyInfo)
+}
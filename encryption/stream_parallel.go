@@ -0,0 +1,232 @@
+package encryption
+
+import (
+	"io"
+	"runtime"
+	"sync"
+)
+
+// MaxParallelMemory is the most memory, in bytes, that the chunks of a parallel reader may use. The number of workers
+// is reduced when the chunk size is too large to run all of them within this budget.
+const MaxParallelMemory = 1024 * 1024 * 1024 // 1GB
+
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+type chunkJob struct {
+	index  uint64
+	last   bool
+	data   []byte
+	result chan chunkResult
+}
+
+// parallelStream reads chunks from a reader and processes up to workers of them at the same time, returning the
+// results in their original order. Each chunk waits in a queue of at most workers results, so about 2*workers chunks
+// are held in memory at once.
+type parallelStream struct {
+	// Called on the first Read. It returns the bytes to send before the first chunk, and how to read and process the
+	// chunks. For decryption, this is where the header is read.
+	start func() ([]byte, parallelChunkConfig, error)
+
+	workers int
+	results chan chan chunkResult
+	quit    chan struct{}
+	stop    sync.Once
+	started bool
+
+	i    int
+	buff []byte
+	err  error
+}
+
+type parallelChunkConfig struct {
+	dataProvider io.Reader
+	// Size of chunks read from dataProvider.
+	chunkSize int
+	// Whether an empty read at the end of the stream is processed as the final chunk.
+	emptyFinal bool
+	// Returned once all chunks are processed, unless emptyFinal is set.
+	endErr  error
+	process func(index uint64, last bool, data []byte) ([]byte, error)
+}
+
+// workerCount returns the number of workers that fit in MaxParallelMemory.
+func workerCount(workers int, chunkSize int) int {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if limit := MaxParallelMemory / (2 * chunkSize); workers > limit {
+		workers = limit
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+func (s *parallelStream) run(config parallelChunkConfig) {
+	workers := workerCount(s.workers, config.chunkSize)
+	s.results = make(chan chan chunkResult, workers)
+	jobs := make(chan chunkJob)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range jobs {
+				data, err := config.process(job.index, job.last, job.data)
+				job.result <- chunkResult{data: data, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		// sendResult queues a result channel in order. It returns false if the stream was closed.
+		sendResult := func(result chan chunkResult) bool {
+			select {
+			case s.results <- result:
+				return true
+			case <-s.quit:
+				return false
+			}
+		}
+		for index := uint64(0); ; index++ {
+			data := make([]byte, config.chunkSize)
+			n, err := readAtLeastOrEof(config.dataProvider, data)
+			if err == nil && n == 0 && !config.emptyFinal {
+				err = config.endErr
+			}
+			if err != nil {
+				result := make(chan chunkResult, 1)
+				result <- chunkResult{err: err}
+				sendResult(result)
+				return
+			}
+			job := chunkJob{index: index, last: n < config.chunkSize, data: data[:n], result: make(chan chunkResult, 1)}
+			if !sendResult(job.result) {
+				return
+			}
+			select {
+			case jobs <- job:
+			case <-s.quit:
+				return
+			}
+			if job.last {
+				result := make(chan chunkResult, 1)
+				result <- chunkResult{err: io.EOF}
+				sendResult(result)
+				return
+			}
+		}
+	}()
+}
+
+func (s *parallelStream) Read(p []byte) (int, error) {
+	if !s.started {
+		s.started = true
+		// Closed before the first Read.
+		if s.err != nil {
+			return 0, s.err
+		}
+		header, config, err := s.start()
+		if err != nil {
+			s.err = err
+			return 0, err
+		}
+		s.buff = header
+		s.run(config)
+	}
+	for {
+		if len(s.buff) > s.i {
+			n := copy(p, s.buff[s.i:])
+			s.i += n
+			return n, nil
+		}
+		if s.err != nil {
+			return 0, s.err
+		}
+		result := <-<-s.results
+		if result.err != nil {
+			s.err = result.err
+			s.Close()
+			continue
+		}
+		s.buff = result.data
+		s.i = 0
+	}
+}
+
+// Close stops all goroutines of the stream. It must be called if the stream is not read until the end. Reading after
+// Close returns io.ErrClosedPipe.
+func (s *parallelStream) Close() error {
+	s.stop.Do(func() {
+		close(s.quit)
+	})
+	// The chunks that were not processed yet never will be, so Read must not wait for them.
+	if s.err == nil {
+		s.err = io.ErrClosedPipe
+		s.buff = nil
+	}
+	return nil
+}
+
+// NewParallelEncryptReader is like NewMultiEncryptReader, but encrypts up to workers chunks at the same time. If
+// workers is less than 1, runtime.NumCPU() is used. The returned reader must be closed if it is not read until the end.
+func NewParallelEncryptReader(publicKeys [][]byte, data io.Reader, bufferSize int, workers int) io.ReadCloser {
+	return NewParallelEncryptReaderWithOptions(publicKeys, data, workers, EncryptOptions{BufferSize: bufferSize, Version: MagicBytesVersion4})
+}
+
+// NewParallelEncryptReaderWithOptions is like NewEncryptReaderWithOptions, but encrypts up to workers chunks at the
+// same time. If workers is less than 1, runtime.NumCPU() is used. The returned reader must be closed if it is not read
+// until the end.
+func NewParallelEncryptReaderWithOptions(publicKeys [][]byte, data io.Reader, workers int, options EncryptOptions) io.ReadCloser {
+	options = options.withDefaults()
+	s := &parallelStream{workers: workers, quit: make(chan struct{})}
+	s.start = func() ([]byte, parallelChunkConfig, error) {
+		sealer, err := newChunkSealer(publicKeys, options)
+		if err != nil {
+			return nil, parallelChunkConfig{}, err
+		}
+		return sealer.header(), parallelChunkConfig{
+			dataProvider: data,
+			chunkSize:    options.BufferSize,
+			emptyFinal:   sealer.terminated(),
+			endErr:       io.EOF,
+			process:      sealer.seal,
+		}, nil
+	}
+	return s
+}
+
+// NewParallelDecryptReader is like NewDecryptReader, but decrypts up to workers chunks at the same time. If workers is
+// less than 1, runtime.NumCPU() is used. The returned reader must be closed if it is not read until the end.
+func NewParallelDecryptReader(privateKey []byte, data io.Reader, workers int) io.ReadCloser {
+	return NewParallelDecryptReaderWithOptions(privateKey, data, workers, DecryptOptions{})
+}
+
+// NewParallelDecryptReaderWithOptions is like NewDecryptReaderWithOptions, but decrypts up to workers chunks at the
+// same time. If workers is less than 1, runtime.NumCPU() is used. The returned reader must be closed if it is not read
+// until the end.
+func NewParallelDecryptReaderWithOptions(privateKey []byte, data io.Reader, workers int, options DecryptOptions) io.ReadCloser {
+	s := &parallelStream{workers: workers, quit: make(chan struct{})}
+	s.start = func() ([]byte, parallelChunkConfig, error) {
+		// Read the header exactly like StreamDecryption.
+		d := &StreamDecryption{DataProvider: data, privateKey: privateKey, options: options}
+		if err := d.readKeys(); err != nil {
+			return nil, parallelChunkConfig{}, err
+		}
+		if err := d.readHeader(); err != nil {
+			return nil, parallelChunkConfig{}, err
+		}
+		endErr := io.EOF
+		if d.opener.terminated() {
+			endErr = ErrTruncated
+		}
+		return nil, parallelChunkConfig{
+			dataProvider: data,
+			chunkSize:    d.bufferSize + d.opener.overhead(),
+			endErr:       endErr,
+			process:      d.opener.open,
+		}, nil
+	}
+	return s
+}
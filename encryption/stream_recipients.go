@@ -0,0 +1,317 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/hmac"
+	crypto_ran "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	version4KeyInfo  = "OwO4 payload key"
+	senderTagKeyInfo = "OwO4 sender tag key"
+)
+
+// Size of the tag each recipient of an authenticated stream gets at the end of every chunk.
+const senderTagSize = 16
+
+const (
+	// stanzaTypeAnonymous wraps the file key in an anonymous box for a single recipient.
+	stanzaTypeAnonymous byte = 1
+	// stanzaTypeMetadata holds the Metadata of the stream, encrypted with the file key. It is not for a recipient, and
+	// comes after all of them.
+	stanzaTypeMetadata byte = 3
+	// stanzaTypeSender wraps the file key followed by a random tag key in a box from the sender to a single recipient,
+	// prefixed with the sender's public key and the nonce. Every chunk ends with a tag for each recipient, made with
+	// their tag key, so a recipient who knows the file key can't change the chunks for the others.
+	stanzaTypeSender byte = 4
+	// stanzaFlagKeyId is added to the stanza type when the body starts with the recipient's key ID.
+	stanzaFlagKeyId byte = 0x80
+)
+
+var (
+	// ErrNotAuthenticated is returned when a sender is expected, but the stream is anonymous.
+	ErrNotAuthenticated = errors.New("encrypted stream is not authenticated by a sender")
+	// ErrWrongSender is returned when the stream is authenticated by a different sender than expected.
+	ErrWrongSender = errors.New("encrypted stream is authenticated by a different sender")
+)
+
+// RecipientError is returned when a private key does not match any recipient of an encrypted stream.
+type RecipientError struct {
+	// Number of recipients the stream was encrypted for.
+	Recipients int
+	// Fingerprints of the recipients whose key IDs are in the header. Empty if the stream was encrypted without
+	// EncryptOptions.IncludeKeyIds.
+	Fingerprints []string
+}
+
+func (e *RecipientError) Error() string {
+	if len(e.Fingerprints) != 0 {
+		return "wrong private key, this file is for " + strings.Join(e.Fingerprints, ", ")
+	}
+	return "private key does not match any of the " + strconv.Itoa(e.Recipients) + " recipients of the encrypted stream"
+}
+
+// stanza wraps the file key of a version 4 stream for one recipient.
+type stanza struct {
+	stanzaType byte
+	body       []byte
+}
+
+func (s stanza) bytes() []byte {
+	b := make([]byte, 3, 3+len(s.body))
+	b[0] = s.stanzaType
+	binary.BigEndian.PutUint16(b[1:], uint16(len(s.body)))
+	return append(b, s.body...)
+}
+
+func readStanza(r io.Reader) (stanza, error) {
+	b := make([]byte, 3)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return stanza{}, err
+	}
+	// The size is a uint16, so a corrupt header can't make the body larger than 64 KiB.
+	s := stanza{stanzaType: b[0], body: make([]byte, binary.BigEndian.Uint16(b[1:]))}
+	if _, err := io.ReadFull(r, s.body); err != nil {
+		return stanza{}, err
+	}
+	return s, nil
+}
+
+// newSenderTagKey derives the key of a recipient's chunk tags from the tag key in their stanza, with the whole header
+// as the salt.
+func newSenderTagKey(secret []byte, header []byte) ([]byte, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, header, []byte(senderTagKeyInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// senderTag returns the tag of the sealed chunk at position index for the recipient with tagKey.
+func senderTag(tagKey []byte, index uint64, last bool, sealed []byte) []byte {
+	mac := hmac.New(sha256.New, tagKey)
+	mac.Write(payloadNonce(index, last))
+	mac.Write(sealed)
+	return mac.Sum(nil)[:senderTagSize]
+}
+
+// version4Sealer wraps a random file key for every recipient, then seals all chunks with a payloadCipher derived from
+// the file key. If the stream is authenticated, every chunk is followed by a tag for each recipient.
+type version4Sealer struct {
+	*payloadCipher
+	headerData []byte
+	// Keys of the chunk tags, in the order of the recipients. Empty if the stream is anonymous.
+	tagKeys [][]byte
+}
+
+func newVersion4Sealer(publicKeys [][]byte, options EncryptOptions) (*version4Sealer, error) {
+	stanzas := len(publicKeys)
+	if options.Metadata != nil {
+		stanzas++
+	}
+	if len(publicKeys) < 1 || stanzas > 0xffff {
+		return nil, errors.New("invalid number of recipients: " + strconv.Itoa(len(publicKeys)))
+	}
+	fileKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := crypto_ran.Read(fileKey); err != nil {
+		return nil, err
+	}
+	header := baseHeader(MagicBytesVersion4, options.BufferSize)
+	header = binary.BigEndian.AppendUint16(header, uint16(stanzas))
+	var tagKeys [][]byte
+	for _, publicKey := range publicKeys {
+		if len(publicKey) != 32 {
+			return nil, errors.New("invalid public key size: " + strconv.Itoa(len(publicKey)))
+		}
+		s := stanza{stanzaType: stanzaTypeAnonymous}
+		var err error
+		if options.SenderPrivateKey != nil {
+			tagKey := make([]byte, 32)
+			if _, err := crypto_ran.Read(tagKey); err != nil {
+				return nil, err
+			}
+			tagKeys = append(tagKeys, tagKey)
+			s.stanzaType = stanzaTypeSender
+			s.body, err = AuthenticatedEncrypt(options.SenderPrivateKey, publicKey, append(append([]byte{}, fileKey...), tagKey...))
+		} else {
+			s.body, err = PublicKeyEncrypt(publicKey, fileKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if options.IncludeKeyIds {
+			s.stanzaType |= stanzaFlagKeyId
+			s.body = append(KeyId(publicKey), s.body...)
+		}
+		header = append(header, s.bytes()...)
+	}
+	if options.Metadata != nil {
+		body, err := sealMetadata(fileKey, header, options.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, stanza{stanzaType: stanzaTypeMetadata, body: body}.bytes()...)
+	}
+	payload, err := newPayloadCipher(fileKey, header, version4KeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	for i, tagKey := range tagKeys {
+		if tagKeys[i], err = newSenderTagKey(tagKey, header); err != nil {
+			return nil, err
+		}
+	}
+	return &version4Sealer{payloadCipher: payload, headerData: header, tagKeys: tagKeys}, nil
+}
+
+func (v *version4Sealer) header() []byte {
+	return v.headerData
+}
+
+func (v *version4Sealer) seal(index uint64, last bool, plainText []byte) ([]byte, error) {
+	sealed, err := v.payloadCipher.seal(index, last, plainText)
+	if err != nil {
+		return nil, err
+	}
+	result := sealed
+	for _, tagKey := range v.tagKeys {
+		result = append(result, senderTag(tagKey, index, last, sealed)...)
+	}
+	return result, nil
+}
+
+// senderTagOpener checks the tag of a recipient at the end of every chunk of an authenticated stream, then opens the
+// chunk with a payloadCipher.
+type senderTagOpener struct {
+	*payloadCipher
+	tagKey []byte
+	// Position of the recipient's tag, and the number of tags after every chunk.
+	position int
+	tags     int
+}
+
+func (v *senderTagOpener) open(index uint64, last bool, encryptedData []byte) ([]byte, error) {
+	tagsStart := len(encryptedData) - v.tags*senderTagSize
+	if tagsStart < 0 {
+		return nil, ErrCorrupt
+	}
+	sealed := encryptedData[:tagsStart]
+	tag := encryptedData[tagsStart+v.position*senderTagSize:][:senderTagSize]
+	if !hmac.Equal(tag, senderTag(v.tagKey, index, last, sealed)) {
+		return nil, ErrCorrupt
+	}
+	return v.payloadCipher.open(index, last, sealed)
+}
+
+func (v *senderTagOpener) overhead() int {
+	return v.payloadCipher.overhead() + v.tags*senderTagSize
+}
+
+// version4Header is what readVersion4Header found in a version 4 header.
+type version4Header struct {
+	opener chunkOpener
+	// Public key of the sender, if the matching stanza is authenticated.
+	sender []byte
+	// Metadata of the stream, if it has any.
+	metadata *Metadata
+}
+
+// readVersion4Header reads the stanzas of a version 4 header and unwraps the file key with the first one that matches
+// privateKey. header contains the bytes read so far.
+func readVersion4Header(r io.Reader, header []byte, publicKey []byte, privateKey []byte) (*version4Header, error) {
+	header = append([]byte{}, header...)
+	count := make([]byte, 2)
+	if _, err := io.ReadFull(r, count); err != nil {
+		return nil, errors.New("error reading header: " + err.Error())
+	}
+	header = append(header, count...)
+	stanzas := int(binary.BigEndian.Uint16(count))
+	recipients := 0
+	keyId := KeyId(publicKey)
+	var fileKey, sender, tagKey []byte
+	// Type and position of the stanza that matched.
+	var matchType byte
+	var position int
+	var fingerprints []string
+	// The metadata stanza, and the header before it.
+	var metadataBody, metadataHeader []byte
+	for i := 0; i < stanzas; i++ {
+		s, err := readStanza(r)
+		if err != nil {
+			return nil, errors.New("error reading header: " + err.Error())
+		}
+		if s.stanzaType == stanzaTypeMetadata {
+			if metadataBody != nil {
+				return nil, errors.New("invalid encryption header: more than one metadata stanza")
+			}
+			metadataBody, metadataHeader = s.body, append([]byte{}, header...)
+			header = append(header, s.bytes()...)
+			continue
+		}
+		recipients++
+		header = append(header, s.bytes()...)
+		// Keep reading after a match, since the payload key depends on the whole header.
+		if fileKey != nil {
+			continue
+		}
+		body := s.body
+		if s.stanzaType&stanzaFlagKeyId != 0 {
+			if len(body) < KeyIdSize {
+				continue
+			}
+			fingerprints = append(fingerprints, formatKeyId(body[:KeyIdSize]))
+			// Skip stanzas for other keys without trying to decrypt them.
+			if !bytes.Equal(body[:KeyIdSize], keyId) {
+				continue
+			}
+			body = body[KeyIdSize:]
+		}
+		var key []byte
+		keySize := chacha20poly1305.KeySize
+		switch s.stanzaType &^ stanzaFlagKeyId {
+		case stanzaTypeAnonymous:
+			key, err = DecryptWithPublicKey(publicKey, privateKey, body)
+		case stanzaTypeSender:
+			key, sender, err = AuthenticatedDecrypt(privateKey, body)
+			keySize += 32
+		default:
+			continue
+		}
+		if err == nil && len(key) == keySize {
+			fileKey, tagKey = key[:chacha20poly1305.KeySize], key[chacha20poly1305.KeySize:]
+			matchType, position = s.stanzaType&^stanzaFlagKeyId, recipients-1
+		} else {
+			sender = nil
+		}
+	}
+	if fileKey == nil {
+		return nil, &RecipientError{Recipients: recipients, Fingerprints: fingerprints}
+	}
+	payload, err := newPayloadCipher(fileKey, header, version4KeyInfo)
+	if err != nil {
+		return nil, err
+	}
+	var opener chunkOpener = payload
+	if matchType == stanzaTypeSender {
+		key, err := newSenderTagKey(tagKey, header)
+		if err != nil {
+			return nil, err
+		}
+		opener = &senderTagOpener{payloadCipher: payload, tagKey: key, position: position, tags: recipients}
+	}
+	result := &version4Header{opener: opener, sender: sender}
+	if metadataBody != nil {
+		if result.metadata, err = openMetadata(fileKey, metadataHeader, metadataBody); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,173 @@
+package encryption
+
+import (
+	"errors"
+	"io"
+)
+
+// StreamEncryptionWriter encrypts everything written to it and writes it to Destination, using the same format as
+// StreamEncryption. Close must be called to write the final chunk.
+type StreamEncryptionWriter struct {
+	Destination io.Writer
+
+	// Unencrypted data waiting to be sealed.
+	buff       []byte
+	publicKeys [][]byte
+	options    EncryptOptions
+	sealer     chunkSealer
+	// Index of the next chunk to be encrypted.
+	index  uint64
+	closed bool
+	// First error returned by Destination. All later calls return it.
+	err error
+}
+
+func (s *StreamEncryptionWriter) writeHeader() error {
+	sealer, err := newChunkSealer(s.publicKeys, s.options)
+	if err != nil {
+		return err
+	}
+	s.sealer = sealer
+	s.buff = make([]byte, 0, s.options.BufferSize)
+	_, err = s.Destination.Write(sealer.header())
+	return err
+}
+
+func (s *StreamEncryptionWriter) writeChunk(last bool) error {
+	encrypted, err := s.sealer.seal(s.index, last, s.buff)
+	if err != nil {
+		return err
+	}
+	s.index++
+	s.buff = s.buff[:0]
+	_, err = s.Destination.Write(encrypted)
+	return err
+}
+
+func (s *StreamEncryptionWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.closed {
+		return 0, errors.New("write to closed encryption writer")
+	}
+	if s.sealer == nil {
+		if s.err = s.writeHeader(); s.err != nil {
+			return 0, s.err
+		}
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, since the final chunk must be marked as such.
+		if len(s.buff) == s.options.BufferSize {
+			if s.err = s.writeChunk(false); s.err != nil {
+				return written, s.err
+			}
+		}
+		n := copy(s.buff[len(s.buff):s.options.BufferSize], p)
+		s.buff = s.buff[:len(s.buff)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close encrypts and writes the final chunk. It does not close Destination.
+func (s *StreamEncryptionWriter) Close() error {
+	if s.err != nil || s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.sealer == nil {
+		if s.err = s.writeHeader(); s.err != nil {
+			return s.err
+		}
+	}
+	// Same as StreamEncryption: the final chunk is always smaller than the buffer size.
+	if len(s.buff) == s.options.BufferSize {
+		if s.err = s.writeChunk(false); s.err != nil {
+			return s.err
+		}
+	}
+	if len(s.buff) != 0 || s.sealer.terminated() {
+		s.err = s.writeChunk(true)
+	}
+	return s.err
+}
+
+func NewEncryptWriter(publicKey []byte, w io.Writer) io.WriteCloser {
+	return NewEncryptWriterWithOptions([][]byte{publicKey}, w, EncryptOptions{})
+}
+
+func NewEncryptWriterWithBufferSize(publicKey []byte, w io.Writer, bufferSize int) io.WriteCloser {
+	return NewEncryptWriterWithOptions([][]byte{publicKey}, w, EncryptOptions{BufferSize: bufferSize})
+}
+
+// NewEncryptWriterWithVersion is the io.WriteCloser equivalent of NewEncryptReaderWithVersion.
+func NewEncryptWriterWithVersion(publicKey []byte, w io.Writer, bufferSize int, version string) io.WriteCloser {
+	return NewEncryptWriterWithOptions([][]byte{publicKey}, w, EncryptOptions{BufferSize: bufferSize, Version: version})
+}
+
+// NewMultiEncryptWriter is the io.WriteCloser equivalent of NewMultiEncryptReader.
+func NewMultiEncryptWriter(publicKeys [][]byte, w io.Writer, bufferSize int) io.WriteCloser {
+	return NewEncryptWriterWithOptions(publicKeys, w, EncryptOptions{BufferSize: bufferSize, Version: MagicBytesVersion4})
+}
+
+// NewEncryptWriterWithOptions is the io.WriteCloser equivalent of NewEncryptReaderWithOptions.
+func NewEncryptWriterWithOptions(publicKeys [][]byte, w io.Writer, options EncryptOptions) io.WriteCloser {
+	return &StreamEncryptionWriter{
+		Destination: w,
+		publicKeys:  publicKeys,
+		options:     options.withDefaults(),
+	}
+}
+
+// StreamDecryptionWriter decrypts everything written to it and writes the plain text to a destination. It runs a
+// StreamDecryption in a separate goroutine, so that headers and chunks are handled exactly like NewDecryptReader.
+// Close must be called to decrypt the final chunk and stop the goroutine.
+type StreamDecryptionWriter struct {
+	pipe *io.PipeWriter
+	// Receives the result of the decryption goroutine.
+	done   chan error
+	closed bool
+	err    error
+}
+
+func (s *StreamDecryptionWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed decryption writer")
+	}
+	return s.pipe.Write(p)
+}
+
+// Close decrypts the final chunk and returns any error from decryption, such as a truncated stream. It does not close
+// the destination.
+func (s *StreamDecryptionWriter) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	s.pipe.Close()
+	s.err = <-s.done
+	return s.err
+}
+
+func NewDecryptWriter(privateKey []byte, w io.Writer) io.WriteCloser {
+	return NewDecryptWriterWithOptions(privateKey, w, DecryptOptions{})
+}
+
+// NewDecryptWriterWithOptions is the io.WriteCloser equivalent of NewDecryptReaderWithOptions.
+func NewDecryptWriterWithOptions(privateKey []byte, w io.Writer, options DecryptOptions) io.WriteCloser {
+	pr, pw := io.Pipe()
+	s := &StreamDecryptionWriter{
+		pipe: pw,
+		done: make(chan error, 1),
+	}
+	go func() {
+		_, err := io.Copy(w, NewDecryptReaderWithOptions(privateKey, pr, options))
+		// Unblock Write, returning the decryption error if there was one.
+		pr.CloseWithError(err)
+		s.done <- err
+	}()
+	return s
+}
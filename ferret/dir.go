@@ -0,0 +1,307 @@
+package ferret
+
+import (
+	"archive/tar"
+	"errors"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UnsafePathError is returned by DecryptDir for an archive entry that would be extracted outside of the output
+// directory, such as one with an absolute path or "..".
+type UnsafePathError struct {
+	Name string
+}
+
+func (e *UnsafePathError) Error() string {
+	return "archive contains an unsafe path: " + e.Name
+}
+
+// dirEntry is a file, directory or symlink found in the directory being encrypted.
+type dirEntry struct {
+	path string
+	name string
+	info fs.FileInfo
+}
+
+// EncryptDir encrypts the directory tree at dirPath for every key in publicKeys and writes it to outFilePath as a
+// single encrypted tar archive, failing if outFilePath exists. Like EncryptFile, outFilePath is never left partly
+// written. Names, modes, modification times and symlinks are kept. The plain tar archive is never written to disk. It
+// uses every CPU core.
+func EncryptDir(dirPath string, outFilePath string, publicKeys [][]byte) error {
+	return EncryptDirWithOptions(dirPath, outFilePath, publicKeys, EncryptFileOptions{})
+}
+
+// EncryptDirWithOptions is like EncryptDir, but encrypts using options. If options.BufferSize is 0, it is chosen based
+// on the size of the files.
+func EncryptDirWithOptions(dirPath string, outFilePath string, publicKeys [][]byte, options EncryptFileOptions) error {
+	entries, size, err := readDirEntries(dirPath)
+	if err != nil {
+		return err
+	}
+	if options.BufferSize == 0 {
+		options.BufferSize = bufferSize(size, options.Workers)
+	}
+	saveFile, err := createOutput(outFilePath, options.Force)
+	if err != nil {
+		return err
+	}
+	defer saveFile.Abort()
+
+	reader, writer := io.Pipe()
+	// Stops writeTar if encrypting fails.
+	defer reader.Close()
+	go func() {
+		writer.CloseWithError(writeTar(writer, entries))
+	}()
+
+	encryptor := encryption.NewParallelEncryptReaderWithOptions(publicKeys, reader, options.Workers, options.EncryptOptions)
+	defer encryptor.Close()
+	_, err = io.Copy(saveFile, encryptor)
+	if err != nil {
+		return err
+	}
+	return saveFile.Commit()
+}
+
+// readDirEntries returns everything in the directory tree at dirPath, and about how large its tar archive will be.
+func readDirEntries(dirPath string) ([]dirEntry, int64, error) {
+	stat, err := os.Stat(dirPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !stat.IsDir() {
+		return nil, 0, errors.New(dirPath + " is not a directory")
+	}
+	var entries []dirEntry
+	// Two blocks of zeros end the archive.
+	size := int64(1024)
+	err = filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dirPath {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			return errors.New("cannot encrypt " + path + ", only files, directories and symlinks are supported")
+		}
+		name, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, dirEntry{path: path, name: filepath.ToSlash(name), info: info})
+		// A header block, room for a PAX header with a long name, and the contents padded to a whole block.
+		size += 3*512 + (info.Size()+511)/512*512
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return entries, size, nil
+}
+
+// writeTar writes entries to w as a tar archive.
+func writeTar(w io.Writer, entries []dirEntry) error {
+	tw := tar.NewWriter(w)
+	for _, entry := range entries {
+		link := ""
+		if entry.info.Mode()&fs.ModeSymlink != 0 {
+			var err error
+			link, err = os.Readlink(entry.path)
+			if err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(entry.info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.name
+		if entry.info.IsDir() {
+			header.Name += "/"
+		}
+		// Don't leak the owner's user and group.
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !entry.info.Mode().IsRegular() {
+			continue
+		}
+		file, err := os.Open(entry.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, file, header.Size)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// DecryptDir decrypts an archive created by EncryptDir from inFilePath using the privateKey, and extracts it to
+// outDirPath, which must not exist yet. Entries that would be extracted outside of outDirPath are refused with
+// an *UnsafePathError. The archive is extracted to a temporary directory that is renamed to outDirPath once everything
+// is extracted, so if anything fails, nothing is left behind. It uses every CPU core.
+func DecryptDir(inFilePath string, outDirPath string, privateKey []byte) error {
+	return DecryptDirWithOptions(inFilePath, outDirPath, privateKey, DecryptFileOptions{})
+}
+
+// DecryptDirWithOptions is like DecryptDir, but decrypts using options. An existing outDirPath is never replaced, even
+// with options.Force.
+func DecryptDirWithOptions(inFilePath string, outDirPath string, privateKey []byte, options DecryptFileOptions) error {
+	file, _, err := openInput(inFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := checkOutput(outDirPath, false); err != nil {
+		return err
+	}
+	tempDirPath, err := os.MkdirTemp(filepath.Dir(outDirPath), "."+filepath.Base(outDirPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	decryptor := encryption.NewParallelDecryptReaderWithOptions(privateKey, file, options.Workers, options.DecryptOptions)
+	defer decryptor.Close()
+	err = extractTar(decryptor, tempDirPath)
+	if err == nil {
+		// An empty directory may have been created while extracting, and renaming would replace it.
+		err = checkOutput(outDirPath, false)
+	}
+	if err == nil {
+		err = os.Rename(tempDirPath, outDirPath)
+	}
+	if err != nil {
+		removeDir(tempDirPath)
+		return err
+	}
+	return nil
+}
+
+// removeDir removes the directory tree at path, including directories that were made read-only.
+func removeDir(path string) {
+	filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(path, 0700)
+		}
+		return nil
+	})
+	os.RemoveAll(path)
+}
+
+// extractTar extracts the tar archive in r to dirPath.
+func extractTar(r io.Reader, dirPath string) error {
+	type dirTimes struct {
+		path    string
+		mode    fs.FileMode
+		modTime time.Time
+	}
+	type symlink struct {
+		name   string
+		path   string
+		target string
+	}
+	// Directories are kept writable until everything is extracted, and their modification time would change when
+	// files are added, so both are set at the end.
+	var dirs []dirTimes
+	// Symlinks are created last, so no entry can be written through one.
+	var symlinks []symlink
+	// Names of the symlinks. Entries inside of one are refused, since the symlink may point outside of dirPath.
+	symlinkNames := map[string]bool{}
+	inSymlink := func(name string) bool {
+		for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+			if symlinkNames[dir] {
+				return true
+			}
+		}
+		return false
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) || inSymlink(filepath.Clean(name)) {
+			return &UnsafePathError{Name: header.Name}
+		}
+		path := filepath.Join(dirPath, name)
+		mode := header.FileInfo().Mode().Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(path, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirTimes{path: path, mode: mode, modTime: header.ModTime})
+		case tar.TypeReg:
+			if err := extractFile(tr, path, mode, header.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			symlinks = append(symlinks, symlink{name: header.Name, path: path, target: header.Linkname})
+			symlinkNames[filepath.Clean(name)] = true
+		default:
+			return errors.New("archive contains an unsupported entry: " + header.Name)
+		}
+	}
+	// The tar archive ends before the final chunk is read, so read the rest to make sure it wasn't cut off.
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	for _, link := range symlinks {
+		// A symlink may come before the one it is inside of.
+		if inSymlink(filepath.Clean(filepath.FromSlash(link.name))) {
+			return &UnsafePathError{Name: link.name}
+		}
+		if err := os.Symlink(link.target, link.path); err != nil {
+			return err
+		}
+	}
+	// In reverse, so the children of a directory are done before it.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes the contents of a regular file from r to path, which must not exist yet.
+func extractFile(r io.Reader, path string, mode fs.FileMode, modTime time.Time) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
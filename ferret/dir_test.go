@@ -0,0 +1,125 @@
+package ferret
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncryptDir(t *testing.T) {
+	publicKey, privateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "sub", "a.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub/a.txt", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "sub"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(src, "sub"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := filepath.Join(dir, "src.tar.enc")
+	if err := EncryptDir(src, encrypted, [][]byte{publicKey}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := DecryptDir(encrypted, out, privateKey); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatal("expected hello, got", string(data))
+	}
+	stat, err := os.Stat(filepath.Join(out, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0750 || !stat.ModTime().Equal(modTime) {
+		t.Fatal("sub has mode", stat.Mode(), "and modification time", stat.ModTime())
+	}
+	if err := DecryptDir(encrypted, out, privateKey); err == nil {
+		t.Fatal("expected an error extracting to an existing directory")
+	}
+}
+
+func TestDecryptDirUnsafePaths(t *testing.T) {
+	publicKey, privateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{"parent", []*tar.Header{{Name: "../evil", Typeflag: tar.TypeReg}}},
+		{"nested parent", []*tar.Header{{Name: "a/../../evil", Typeflag: tar.TypeReg}}},
+		{"absolute", []*tar.Header{{Name: "/tmp/evil", Typeflag: tar.TypeReg}}},
+		{"through symlink", []*tar.Header{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "link/evil", Typeflag: tar.TypeReg},
+		}},
+		{"symlink through symlink", []*tar.Header{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "link/evil", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		}},
+		{"symlink before symlink", []*tar.Header{
+			{Name: "dir", Typeflag: tar.TypeDir, Mode: 0700},
+			{Name: "dir/link/evil", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+			{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			tw := tar.NewWriter(&archive)
+			for _, header := range test.headers {
+				if err := tw.WriteHeader(header); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			encrypted, err := io.ReadAll(encryption.NewEncryptReader(publicKey, &archive))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			inFilePath := filepath.Join(dir, "evil.tar.enc")
+			if err := os.WriteFile(inFilePath, encrypted, 0600); err != nil {
+				t.Fatal(err)
+			}
+			out := filepath.Join(dir, "out")
+			if _, ok := DecryptDir(inFilePath, out, privateKey).(*UnsafePathError); !ok {
+				t.Fatal("expected an *UnsafePathError")
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+				t.Fatal("file was written outside of the output directory")
+			}
+			if _, err := os.Lstat(out); !os.IsNotExist(err) {
+				t.Fatal("output directory was not removed")
+			}
+		})
+	}
+}
@@ -2,62 +2,241 @@
 package ferret
 
 import (
+	"bytes"
 	"github.com/masquernya/go-encryption-program/encryption"
 	"io"
+	"io/fs"
+	"mime"
 	"os"
+	"path/filepath"
+	"runtime"
 )
 
-// EncryptFile encrypts the inFilePath using publicKey and writes it to outFilePath, truncating the outFilePath if it exists.
+// Max buffer size 128MB
+const maxBufferSize = 1024 * 1024 * 128
+
+// Buffer size 1MB when the size of the data is unknown, such as for stdin. Output starts after the first chunk, so it
+// is kept small.
+const streamBufferSize = 1024 * 1024
+
+// StdioPath can be used as an input path to read from stdin, or as an output path to write to stdout. Output to stdout
+// is written as it is encrypted or decrypted, so it is not protected from being left partly written.
+const StdioPath = "-"
+
+// bufferSize returns the chunk size for encrypting size bytes with workers at the same time. size is -1 if it is
+// unknown.
+func bufferSize(size int64, workers int) int {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	// Use smaller chunks when there are many workers, so all of them fit in memory at once.
+	maxSize := encryption.MaxParallelMemory / (2 * workers)
+	if maxSize > maxBufferSize {
+		maxSize = maxBufferSize
+	}
+	if size < 0 {
+		if streamBufferSize < maxSize {
+			return streamBufferSize
+		}
+		return maxSize
+	}
+	if size < int64(maxSize) {
+		// The final chunk is always smaller than the buffer size, so leave room for one byte more than the data.
+		return int(size) + 1
+	}
+	return maxSize
+}
+
+// EncryptFileOptions are the options of EncryptFileWithOptions and EncryptDirWithOptions.
+type EncryptFileOptions struct {
+	encryption.EncryptOptions
+	// Number of chunks to encrypt at the same time. If it is less than 1, runtime.NumCPU() is used.
+	Workers int
+	// Replace the output file if it exists. Otherwise, an existing output file is an error that os.IsExist reports.
+	Force bool
+	// Encrypt the name, mode, modification time, size and content type of the file into the header, unless
+	// EncryptOptions.Metadata is already set. Not supported for directories.
+	IncludeMetadata bool
+}
+
+// DecryptFileOptions are the options of DecryptFileWithOptions and DecryptDirWithOptions.
+type DecryptFileOptions struct {
+	encryption.DecryptOptions
+	// Number of chunks to decrypt at the same time. If it is less than 1, runtime.NumCPU() is used.
+	Workers int
+	// Replace the output file if it exists. Otherwise, an existing output file is an error that os.IsExist reports.
+	Force bool
+	// Give the output file the mode and modification time from the metadata of the encrypted file, if it has any.
+	RestoreMetadata bool
+}
+
+// EncryptFile encrypts the inFilePath using publicKey and writes it to outFilePath, failing if outFilePath exists. The output is written to a temporary file that is renamed to outFilePath once it is complete, so it is never left partly written. It uses every CPU core.
 func EncryptFile(inFilePath string, outFilePath string, publicKey []byte) error {
-	file, err := os.Open(inFilePath)
+	return EncryptFileWithWorkers(inFilePath, outFilePath, [][]byte{publicKey}, 0)
+}
+
+// EncryptFileForRecipients encrypts the inFilePath for every key in publicKeys and writes it to outFilePath, failing if outFilePath exists. The output is written to a temporary file that is renamed to outFilePath once it is complete, so it is never left partly written. Any one of the matching private keys can decrypt it. It uses every CPU core.
+func EncryptFileForRecipients(inFilePath string, outFilePath string, publicKeys [][]byte) error {
+	return EncryptFileWithWorkers(inFilePath, outFilePath, publicKeys, 0)
+}
+
+// EncryptFileWithWorkers is like EncryptFileForRecipients, but encrypts up to workers chunks at the same time. If workers is less than 1, runtime.NumCPU() is used.
+func EncryptFileWithWorkers(inFilePath string, outFilePath string, publicKeys [][]byte, workers int) error {
+	return EncryptFileWithOptions(inFilePath, outFilePath, publicKeys, EncryptFileOptions{Workers: workers})
+}
+
+// EncryptFileWithOptions is like EncryptFileForRecipients, but encrypts using options. If options.BufferSize is 0, it is chosen based on the size of the file.
+func EncryptFileWithOptions(inFilePath string, outFilePath string, publicKeys [][]byte, options EncryptFileOptions) error {
+	file, stat, err := openInput(inFilePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	stat, err := file.Stat()
-	if err != nil {
-		return err
+	size := int64(-1)
+	if stat != nil {
+		size = stat.Size()
 	}
-	bufferSize := 1024 * 16
-	fileSize := stat.Size()
-	// Max buffer size 128MB
-	if fileSize > 1024*1024*128 {
-		bufferSize = 1024 * 1024 * 128
-	} else {
-		bufferSize = int(fileSize)
+	if options.BufferSize == 0 {
+		options.BufferSize = bufferSize(size, options.Workers)
 	}
-	saveFile, err := os.OpenFile(outFilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if options.IncludeMetadata && options.Metadata == nil && stat != nil {
+		options.Metadata = fileMetadata(stat)
+	}
+	saveFile, err := createOutput(outFilePath, options.Force)
 	if err != nil {
 		return err
 	}
-	defer saveFile.Close()
+	defer saveFile.Abort()
 
-	encryptor := encryption.NewEncryptReaderWithBufferSize(publicKey, file, bufferSize)
+	encryptor := encryption.NewParallelEncryptReaderWithOptions(publicKeys, file, options.Workers, options.EncryptOptions)
+	defer encryptor.Close()
 	_, err = io.Copy(saveFile, encryptor)
 	if err != nil {
 		return err
 	}
-	return nil
+	return saveFile.Commit()
 }
 
-// DecryptFile decrypts the inFilePath to outFilePath using the privateKey, truncating outFilePath if it exists.
+// DecryptFile decrypts the inFilePath to outFilePath using the privateKey, failing if outFilePath exists. The output is written to a temporary file that is renamed to outFilePath once the whole file is decrypted, so a wrong key or corrupt file never leaves partly decrypted output. It uses every CPU core.
 func DecryptFile(inFilePath string, outFilePath string, privateKey []byte) error {
-	file, err := os.Open(inFilePath)
+	return DecryptFileWithWorkers(inFilePath, outFilePath, privateKey, 0)
+}
+
+// DecryptFileWithWorkers is like DecryptFile, but decrypts up to workers chunks at the same time. If workers is less than 1, runtime.NumCPU() is used.
+func DecryptFileWithWorkers(inFilePath string, outFilePath string, privateKey []byte, workers int) error {
+	return DecryptFileWithOptions(inFilePath, outFilePath, privateKey, DecryptFileOptions{Workers: workers})
+}
+
+// DecryptFileWithOptions is like DecryptFile, but decrypts using options.
+func DecryptFileWithOptions(inFilePath string, outFilePath string, privateKey []byte, options DecryptFileOptions) error {
+	file, _, err := openInput(inFilePath)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	outFile, err := os.OpenFile(outFilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	var data io.Reader = file
+	var metadata *encryption.Metadata
+	if options.RestoreMetadata {
+		// Keep the header, which only ReadMetadata reads, so it can be decrypted again without seeking.
+		header := &bytes.Buffer{}
+		if metadata, err = encryption.ReadMetadata(privateKey, io.TeeReader(file, header)); err != nil {
+			return err
+		}
+		data = io.MultiReader(header, file)
+	}
+	outFile, err := createOutput(outFilePath, options.Force)
 	if err != nil {
 		return err
 	}
+	defer outFile.Abort()
+	if metadata != nil {
+		if metadata.Mode != 0 {
+			outFile.mode = metadata.Mode.Perm()
+		}
+		outFile.modTime = metadata.ModTime
+	}
 
-	decryptor := encryption.NewDecryptReader(privateKey, file)
+	decryptor := encryption.NewParallelDecryptReaderWithOptions(privateKey, data, options.Workers, options.DecryptOptions)
+	defer decryptor.Close()
 	_, err = io.Copy(outFile, decryptor)
 	if err != nil {
 		return err
 	}
-	return nil
+	return outFile.Commit()
+}
+
+// ReadMetadata returns the metadata of the encrypted inFilePath, or nil if it has none. Only the header is decrypted.
+func ReadMetadata(inFilePath string, privateKey []byte) (*encryption.Metadata, error) {
+	file, _, err := openInput(inFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return encryption.ReadMetadata(privateKey, file)
+}
+
+// openInput opens inFilePath, or stdin for StdioPath. The file info is only returned for regular files, since the size
+// of anything else is not known.
+func openInput(inFilePath string) (io.ReadCloser, fs.FileInfo, error) {
+	if inFilePath == StdioPath {
+		// Stdin belongs to the caller, so it is not closed.
+		return io.NopCloser(os.Stdin), nil, nil
+	}
+	file, err := os.Open(inFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if !stat.Mode().IsRegular() {
+		return file, nil, nil
+	}
+	return file, stat, nil
+}
+
+// fileMetadata returns the metadata of a file for EncryptFileOptions.IncludeMetadata.
+func fileMetadata(stat fs.FileInfo) *encryption.Metadata {
+	return &encryption.Metadata{
+		Name:        stat.Name(),
+		Mode:        stat.Mode().Perm(),
+		ModTime:     stat.ModTime(),
+		Size:        stat.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(stat.Name())),
+	}
+}
+
+// SignFile signs the inFilePath with the Ed25519 privateKey and writes the detached signature to signatureFilePath, truncating it if it exists.
+func SignFile(inFilePath string, signatureFilePath string, privateKey []byte) error {
+	file, err := os.Open(inFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	signature, err := encryption.SignReader(privateKey, file)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(signatureFilePath, signature, 0644)
+}
+
+// VerifyFile checks that the detached signature in signatureFilePath was made for inFilePath by the owner of publicKey.
+func VerifyFile(inFilePath string, signatureFilePath string, publicKey []byte) error {
+	signature, err := os.ReadFile(signatureFilePath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(inFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return encryption.VerifyReader(publicKey, file, signature)
 }
@@ -0,0 +1,165 @@
+package ferret
+
+import (
+	"github.com/masquernya/go-encryption-program/encryption"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAtomicOutput(t *testing.T) {
+	publicKey, privateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPrivateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	inFilePath := filepath.Join(dir, "data")
+	if err := os.WriteFile(inFilePath, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "data.enc")
+	if err := EncryptFile(inFilePath, encrypted, publicKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptFile(inFilePath, encrypted, publicKey); !os.IsExist(err) {
+		t.Fatal("expected an exists error, got", err)
+	}
+
+	decrypted := filepath.Join(dir, "data.dec")
+	if err := DecryptFile(encrypted, decrypted, otherPrivateKey); err == nil {
+		t.Fatal("expected an error")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatal("expected only the input and encrypted files, got", entries)
+	}
+
+	if err := os.WriteFile(decrypted, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecryptFile(encrypted, decrypted, privateKey); !os.IsExist(err) {
+		t.Fatal("expected an exists error, got", err)
+	}
+	if err := DecryptFileWithOptions(encrypted, decrypted, otherPrivateKey, DecryptFileOptions{Force: true}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if data, err := os.ReadFile(decrypted); err != nil || string(data) != "old" {
+		t.Fatal("existing file was changed by a failed decryption:", string(data), err)
+	}
+	if err := DecryptFileWithOptions(encrypted, decrypted, privateKey, DecryptFileOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(decrypted); err != nil || string(data) != "hello" {
+		t.Fatal("expected hello, got", string(data), err)
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	publicKey, privateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	inFilePath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(inFilePath, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(inFilePath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "notes.enc")
+	if err := EncryptFileWithOptions(inFilePath, encrypted, [][]byte{publicKey}, EncryptFileOptions{IncludeMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := ReadMetadata(encrypted, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Name != "notes.txt" || metadata.Size != 5 || metadata.Mode != 0600 || !metadata.ModTime.Equal(modTime) || !strings.HasPrefix(metadata.ContentType, "text/plain") {
+		t.Fatal("wrong metadata", metadata)
+	}
+
+	decrypted := filepath.Join(dir, "restored.txt")
+	if err := DecryptFileWithOptions(encrypted, decrypted, privateKey, DecryptFileOptions{RestoreMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 || !stat.ModTime().Equal(modTime) {
+		t.Fatal("restored.txt has mode", stat.Mode(), "and modification time", stat.ModTime())
+	}
+}
+
+func TestBufferSize(t *testing.T) {
+	tests := []struct {
+		size     int64
+		workers  int
+		expected int
+	}{
+		{0, 1, 1},
+		{1000, 1, 1001},
+		{-1, 1, streamBufferSize},
+		{1 << 40, 1, maxBufferSize},
+		// 1GB shared by 2 chunks for each of the 64 workers.
+		{1 << 40, 64, encryption.MaxParallelMemory / 128},
+	}
+	for _, test := range tests {
+		if size := bufferSize(test.size, test.workers); size != test.expected {
+			t.Fatal("expected buffer size", test.expected, "for", test.size, "bytes and", test.workers, "workers, got", size)
+		}
+	}
+}
+
+func TestStdio(t *testing.T) {
+	publicKey, privateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	stdin, stdout := os.Stdin, os.Stdout
+	defer func() {
+		os.Stdin, os.Stdout = stdin, stdout
+	}()
+	// Use files as stdin and stdout.
+	redirect := func(in string, out string) {
+		if os.Stdin != stdin {
+			os.Stdin.Close()
+			os.Stdout.Close()
+		}
+		var err error
+		if os.Stdin, err = os.Open(filepath.Join(dir, in)); err != nil {
+			t.Fatal(err)
+		}
+		if os.Stdout, err = os.Create(filepath.Join(dir, out)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "in"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	redirect("in", "encrypted")
+	if err := EncryptFile(StdioPath, StdioPath, publicKey); err != nil {
+		t.Fatal(err)
+	}
+	redirect("encrypted", "decrypted")
+	if err := DecryptFileWithOptions(StdioPath, StdioPath, privateKey, DecryptFileOptions{RestoreMetadata: true}); err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin.Close()
+	os.Stdout.Close()
+	if data, err := os.ReadFile(filepath.Join(dir, "decrypted")); err != nil || string(data) != "hello" {
+		t.Fatal("expected hello, got", string(data), err)
+	}
+}
@@ -0,0 +1,98 @@
+package ferret
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// existsError is returned when the output already exists and may not be replaced. os.IsExist reports true for it.
+func existsError(path string) error {
+	return &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+}
+
+// checkOutput fails if path exists, unless force is set.
+func checkOutput(path string, force bool) error {
+	if force {
+		return nil
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return existsError(path)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// outputFile is a temporary file in the same directory as its target, which is renamed to the target once it is
+// complete. A failed or interrupted write never leaves a partial file at the target.
+type outputFile struct {
+	*os.File
+	path  string
+	force bool
+	done  bool
+	// True if this is stdout, which is written to directly.
+	stdout bool
+	// Permissions of the file once it is committed.
+	mode fs.FileMode
+	// If set, the modification time of the file once it is committed.
+	modTime time.Time
+}
+
+// createOutput creates a temporary file that replaces path when committed. Unless force is set, it fails if path
+// already exists. For StdioPath, stdout is returned.
+func createOutput(path string, force bool) (*outputFile, error) {
+	if path == StdioPath {
+		return &outputFile{File: os.Stdout, path: path, stdout: true}, nil
+	}
+	if err := checkOutput(path, force); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{File: file, path: path, force: force, mode: 0644}, nil
+}
+
+// Commit flushes the file to disk and renames it to its target.
+func (f *outputFile) Commit() error {
+	if f.stdout {
+		f.done = true
+		return nil
+	}
+	err := f.Chmod(f.mode)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && !f.modTime.IsZero() {
+		err = os.Chtimes(f.Name(), f.modTime, f.modTime)
+	}
+	if err == nil {
+		// The target may have been created while writing.
+		err = checkOutput(f.path, f.force)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	f.done = true
+	return nil
+}
+
+// Abort removes the temporary file, unless it was committed. It is safe to defer.
+func (f *outputFile) Abort() {
+	if f.done || f.stdout {
+		return
+	}
+	f.done = true
+	f.Close()
+	os.Remove(f.Name())
+}
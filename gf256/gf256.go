@@ -0,0 +1,70 @@
+// Package gf256 implements arithmetic in the finite field GF(2^8), using the polynomial x^8 + x^4 + x^3 + x^2 + 1
+// (0x11d) with 2 as the generator.
+package gf256
+
+// Polynomial is the reducing polynomial of the field.
+const Polynomial = 0x11d
+
+var (
+	expTable [510]byte
+	logTable [256]int
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		expTable[i] = byte(x)
+		expTable[i+255] = byte(x)
+		logTable[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= Polynomial
+		}
+	}
+}
+
+// Add returns a + b, which is the same as a - b.
+func Add(a, b byte) byte {
+	return a ^ b
+}
+
+// Mul returns a * b.
+func Mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[logTable[a]+logTable[b]]
+}
+
+// Div returns a / b. It panics if b is 0.
+func Div(a, b byte) byte {
+	if b == 0 {
+		panic("gf256: division by zero")
+	}
+	if a == 0 {
+		return 0
+	}
+	return expTable[logTable[a]+255-logTable[b]]
+}
+
+// Inv returns the multiplicative inverse of a. It panics if a is 0.
+func Inv(a byte) byte {
+	return Div(1, a)
+}
+
+// Exp returns the generator raised to the power n.
+func Exp(n int) byte {
+	n %= 255
+	if n < 0 {
+		n += 255
+	}
+	return expTable[n]
+}
+
+// Log returns n such that Exp(n) == a, between 0 and 254. It panics if a is 0.
+func Log(a byte) int {
+	if a == 0 {
+		panic("gf256: log of zero")
+	}
+	return logTable[a]
+}
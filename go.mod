@@ -2,6 +2,9 @@ module github.com/masquernya/go-encryption-program
 
 go 1.20
 
-require golang.org/x/crypto v0.11.0
+require (
+	golang.org/x/crypto v0.11.0
+	golang.org/x/term v0.10.0
+)
 
 require golang.org/x/sys v0.10.0 // indirect
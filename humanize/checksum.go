@@ -0,0 +1,106 @@
+package humanize
+
+import (
+	"errors"
+	"github.com/masquernya/go-encryption-program/gf256"
+	"strconv"
+)
+
+// ChecksumWords is the number of checksum words GetStringChecked adds after the data.
+const ChecksumWords = 2
+
+// ChecksumError is returned when the checksum words of a humanized string don't match the data.
+type ChecksumError struct {
+	// Index of the word that is probably wrong, starting at 0, or -1 if more than one word is wrong.
+	Position int
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Position < 0 {
+		return "checksum mismatch, more than one word is wrong"
+	}
+	return "checksum mismatch, word " + strconv.Itoa(e.Position+1) + " is probably wrong"
+}
+
+// checksum returns the checksum words for b. Together, b and the checksum form a Reed-Solomon code over GF(256) with
+// 2 check symbols: any 2 wrong words are detected, and the position of a single wrong word can be found. The
+// guarantees only hold for up to 253 bytes.
+func checksum(b []byte) [ChecksumWords]byte {
+	// The word at index i is the coefficient of x^(n-1-i), where n includes the checksum. Both syndromes of the code,
+	// at x=1 and x=2, must be 0.
+	var s0, s1 byte
+	for i, a := range b {
+		s0 = gf256.Add(s0, a)
+		s1 = gf256.Add(s1, gf256.Mul(a, gf256.Exp(len(b)+1-i)))
+	}
+	// Solve s0 + p + q = 0 and s1 + 2p + q = 0 for the checksum words p and q.
+	p := gf256.Div(gf256.Add(s0, s1), gf256.Add(1, 2))
+	return [ChecksumWords]byte{p, gf256.Add(s0, p)}
+}
+
+// verifyChecksum checks the checksum words at the end of b.
+func verifyChecksum(b []byte) error {
+	var s0, s1 byte
+	for i, a := range b {
+		s0 = gf256.Add(s0, a)
+		s1 = gf256.Add(s1, gf256.Mul(a, gf256.Exp(len(b)-1-i)))
+	}
+	if s0 == 0 && s1 == 0 {
+		return nil
+	}
+	if s0 == 0 || s1 == 0 {
+		return &ChecksumError{Position: -1}
+	}
+	// A single error e at the coefficient of x^k gives s0 = e and s1 = e*2^k.
+	k := gf256.Log(s1) - gf256.Log(s0)
+	if k < 0 {
+		k += 255
+	}
+	if k >= len(b) {
+		return &ChecksumError{Position: -1}
+	}
+	return &ChecksumError{Position: len(b) - 1 - k}
+}
+
+// GetBytesChecked returns size bytes from a string returned by GetStringChecked, checking the checksum words. Words are
+// parsed like ParseBytes. Strings without checksum words, such as from GetString, are accepted too, in which case
+// checked is false.
+func (w *Wordlist) GetBytesChecked(s string, size int) (b []byte, checked bool, err error) {
+	b, err = w.ParseBytes(s)
+	if err != nil {
+		return nil, false, err
+	}
+	return CheckBytes(b, size)
+}
+
+// GetBytesChecked is like Wordlist.GetBytesChecked, using the Default word list.
+func GetBytesChecked(s string, size int) ([]byte, bool, error) {
+	return Default.GetBytesChecked(s, size)
+}
+
+// CheckBytes is like GetBytesChecked, but takes the bytes of the words, such as from Resolver.ParseBytes.
+func CheckBytes(b []byte, size int) (data []byte, checked bool, err error) {
+	if len(b) != size && len(b) != size+ChecksumWords {
+		return nil, false, errors.New("expected " + strconv.Itoa(size+ChecksumWords) + " words, got " + strconv.Itoa(len(b)))
+	}
+	if len(b) == size {
+		return b, false, nil
+	}
+	if err := verifyChecksum(b); err != nil {
+		return nil, false, err
+	}
+	return b[:size], true, nil
+}
+
+// StripChecksum checks the checksum words at the end of b, the bytes of words for data of any size, and returns the
+// data before them. Unlike CheckBytes, b must end with checksum words, since without a size they can't be told apart
+// from the data.
+func StripChecksum(b []byte) ([]byte, error) {
+	if len(b) <= ChecksumWords {
+		return nil, errors.New("expected more than " + strconv.Itoa(ChecksumWords) + " words, got " + strconv.Itoa(len(b)))
+	}
+	if err := verifyChecksum(b); err != nil {
+		return nil, err
+	}
+	return b[:len(b)-ChecksumWords], nil
+}
@@ -1,22 +1,71 @@
 package humanize
 
-import "strings"
-
-// GetString returns a human-readable string of the bytes.
-func GetString(b []byte) string {
+// GetString returns a human-readable string of the bytes. GetBytes turns it back into the bytes.
+func (w *Wordlist) GetString(b []byte) string {
 	s := ""
-	for _, a := range b {
-		s += GetWord(a) + " "
+	for i, a := range b {
+		s += w.Word(a, i) + " "
 	}
 	return s
 }
 
-// GetBytes returns a byte array from a human-readable string.
-func GetBytes(s string) []byte {
-	sp := strings.Split(s, " ")
-	b := make([]byte, len(sp))
-	for i, a := range sp {
-		b[i] = GetByte(a)
+// GetStringChecked is like GetString, followed by ChecksumWords checksum words. GetBytesChecked turns it back into the
+// bytes.
+func (w *Wordlist) GetStringChecked(b []byte) string {
+	s := w.GetString(b)
+	for i, a := range checksum(b) {
+		s += w.Word(a, len(b)+i) + " "
+	}
+	return s
+}
+
+// ParseBytes returns a byte array from a human-readable string. Words can be separated by any whitespace or
+// punctuation, and case is ignored. Checksum words are not checked or removed, use GetBytesChecked for that. If a word
+// is unknown, a *WordError is returned.
+func (w *Wordlist) ParseBytes(s string) ([]byte, error) {
+	return w.ParseBytesAt(s, 0)
+}
+
+// ParseBytesAt is like ParseBytes, but parses the words as if the first one was at position start of a longer string,
+// which matters for word lists like PGP. Positions in errors are still counted from the first word of s.
+func (w *Wordlist) ParseBytesAt(s string, start int) ([]byte, error) {
+	words := splitWords(s)
+	b := make([]byte, len(words))
+	for i, a := range words {
+		var err error
+		b[i], err = w.ParseWord(a, start+i)
+		if err != nil {
+			return nil, &WordError{Word: a, Position: i}
+		}
+	}
+	return b, nil
+}
+
+// GetBytes is like ParseBytes, but panics if a word is unknown.
+func (w *Wordlist) GetBytes(s string) []byte {
+	b, err := w.ParseBytes(s)
+	if err != nil {
+		panic(err)
 	}
 	return b
 }
+
+// GetString is like Wordlist.GetString, using the Default word list.
+func GetString(b []byte) string {
+	return Default.GetString(b)
+}
+
+// GetStringChecked is like Wordlist.GetStringChecked, using the Default word list.
+func GetStringChecked(b []byte) string {
+	return Default.GetStringChecked(b)
+}
+
+// ParseBytes is like Wordlist.ParseBytes, using the Default word list.
+func ParseBytes(s string) ([]byte, error) {
+	return Default.ParseBytes(s)
+}
+
+// GetBytes is like Wordlist.GetBytes, using the Default word list.
+func GetBytes(s string) []byte {
+	return Default.GetBytes(s)
+}
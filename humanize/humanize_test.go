@@ -0,0 +1,169 @@
+package humanize
+
+import (
+	"bytes"
+	crypto_ran "crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	key := make([]byte, 32)
+	if _, err := crypto_ran.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	s := GetStringChecked(key)
+	decoded, checked, err := GetBytesChecked(s, len(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checked || !bytes.Equal(decoded, key) {
+		t.Fatal("decoded key does not match original")
+	}
+
+	// Every single wrong word must be found.
+	words := strings.Fields(s)
+	for i := range words {
+		wrong := append([]string{}, words...)
+		wrong[i] = GetWord(GetByte(wrong[i]) + 1)
+		_, _, err := GetBytesChecked(strings.Join(wrong, " "), len(key))
+		checksumErr, ok := err.(*ChecksumError)
+		if !ok {
+			t.Fatal("expected ChecksumError, got", err)
+		}
+		if checksumErr.Position != i {
+			t.Fatal("expected wrong word", i, "got", checksumErr.Position)
+		}
+	}
+
+	// Two wrong words must be detected.
+	wrong := append([]string{}, words...)
+	wrong[3] = GetWord(GetByte(wrong[3]) + 1)
+	wrong[20] = GetWord(GetByte(wrong[20]) + 7)
+	if _, _, err := GetBytesChecked(strings.Join(wrong, " "), len(key)); err == nil {
+		t.Fatal("expected error for two wrong words")
+	}
+
+	// Strings without checksum words are still accepted.
+	decoded, checked, err = GetBytesChecked(strings.Join(words[:len(key)], " "), len(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked || !bytes.Equal(decoded, key) {
+		t.Fatal("decoded key does not match original")
+	}
+
+	// Data of any size can be checked if it ends with checksum words.
+	data := []byte("not a key")
+	b, err := ParseBytes(GetStringChecked(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = StripChecksum(b)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Fatal("decoded data does not match original", decoded, err)
+	}
+	b[3]++
+	if _, err := StripChecksum(b); err == nil {
+		t.Fatal("expected error for a wrong word")
+	}
+	if _, err := StripChecksum(b[:ChecksumWords]); err == nil {
+		t.Fatal("expected error for only checksum words")
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	b, err := ParseBytes("  American, mr.\tTHE\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{GetByte("American"), GetByte("Mr"), GetByte("the")}
+	if !bytes.Equal(b, expected) {
+		t.Fatal("expected", expected, "got", b)
+	}
+	if b := GetBytes(GetString(expected)); !bytes.Equal(b, expected) {
+		t.Fatal("expected", expected, "got", b)
+	}
+
+	_, err = ParseBytes("the teh the")
+	wordErr, ok := err.(*WordError)
+	if !ok {
+		t.Fatal("expected WordError, got", err)
+	}
+	if wordErr.Word != "teh" || wordErr.Position != 1 {
+		t.Fatal("unexpected error", wordErr)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	resolver := &Resolver{}
+	b, corrections, err := resolver.ParseBytes("teh americ thing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{GetByte("the"), GetByte("American"), GetByte("thing")}
+	if !bytes.Equal(b, expected) {
+		t.Fatal("expected", expected, "got", b)
+	}
+	if len(corrections) != 2 || corrections[0].Resolved != "the" || corrections[1].Position != 1 {
+		t.Fatal("unexpected corrections", corrections)
+	}
+
+	_, _, err = resolver.ParseBytes("the th")
+	wordErr, ok := err.(*WordError)
+	if !ok {
+		t.Fatal("expected WordError, got", err)
+	}
+	if len(wordErr.Suggestions) < 2 {
+		t.Fatal("expected suggestions, got", wordErr.Suggestions)
+	}
+
+	resolver.Confirm = func(position int, word string, candidates []string) (string, error) {
+		return candidates[1], nil
+	}
+	b, _, err = resolver.ParseBytes("th")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if GetWord(b[0]) != resolver.Suggest("th", 0)[1] {
+		t.Fatal("confirmed word was not used")
+	}
+}
+
+func TestWordlists(t *testing.T) {
+	key := []byte{0x00, 0x00, 0xff, 0x0a}
+	s := PGP.GetStringChecked(key)
+	if !strings.HasPrefix(s, "aardvark adroitness Zulu Apollo ") {
+		t.Fatal("unexpected PGP words", s)
+	}
+	decoded, checked, err := PGP.GetBytesChecked(s, len(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checked || !bytes.Equal(decoded, key) {
+		t.Fatal("decoded key does not match original")
+	}
+	// Swapped words are at the wrong positions for the PGP list.
+	if _, err := PGP.ParseBytes("adroitness aardvark"); err == nil {
+		t.Fatal("expected error for swapped PGP words")
+	}
+
+	words := make([]string, 256)
+	for i := range words {
+		words[i] = "word" + string(rune('a'+i/26)) + string(rune('a'+i%26))
+	}
+	if _, err := NewWordlist(words); err != nil {
+		t.Fatal(err)
+	}
+	invalid := map[string][]string{
+		"too few words": words[:255],
+		"duplicate":     append(append([]string{}, words[:255]...), "WORDAA"),
+		"prefix":        append(append([]string{}, words[:255]...), "word"),
+		"punctuation":   append(append([]string{}, words[:255]...), "word-z"),
+	}
+	for name, list := range invalid {
+		if _, err := NewWordlist(list); err == nil {
+			t.Fatal("expected error for", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package humanize
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultMaxDistance is the largest edit distance a Resolver corrects when Resolver.MaxDistance is 0.
+const DefaultMaxDistance = 2
+
+// Correction describes a word that a Resolver replaced with a word from the list.
+type Correction struct {
+	// Index of the word, starting at 0.
+	Position int
+	// The word as it was given.
+	Word string
+	// The word from the list it was replaced with.
+	Resolved string
+}
+
+// Resolver parses humanized strings like ParseBytes, but also accepts misspelled words and unique prefixes of words.
+type Resolver struct {
+	// Wordlist to resolve words with. If nil, Default is used.
+	Wordlist *Wordlist
+	// MaxDistance is the largest edit distance of a misspelled word from a word in the list. If 0, DefaultMaxDistance
+	// is used.
+	MaxDistance int
+	// If Confirm is not nil, it is called for every word that is not in the list, with the candidates from Suggest.
+	// It returns the candidate to use, or an error to stop parsing. If Confirm is nil, a word is only corrected when it
+	// has a single candidate.
+	Confirm func(position int, word string, candidates []string) (string, error)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// editDistance returns the optimal string alignment distance between a and b: the number of inserted, deleted or
+// changed letters, or swapped adjacent letters, to turn a into b.
+func editDistance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	d := make([][]int, len(x)+1)
+	for i := range d {
+		d[i] = make([]int, len(y)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(minInt(d[i-1][j]+1, d[i][j-1]+1), d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(x)][len(y)]
+}
+
+func (r *Resolver) wordlist() *Wordlist {
+	if r.Wordlist == nil {
+		return Default
+	}
+	return r.Wordlist
+}
+
+// Suggest returns the words from the list that word at position most likely was meant to be. If word is the start of
+// any words, those are returned. Otherwise, the words with the smallest edit distance are returned, if it is at most
+// the resolver's MaxDistance.
+func (r *Resolver) Suggest(word string, position int) []string {
+	word = normalizeWord(word)
+	if word == "" {
+		return nil
+	}
+	words := r.wordlist().words[position%2]
+	var candidates []string
+	for _, a := range words {
+		if strings.HasPrefix(normalizeWord(a), word) {
+			candidates = append(candidates, a)
+		}
+	}
+	if len(candidates) != 0 {
+		return candidates
+	}
+	best := r.MaxDistance
+	if best == 0 {
+		best = DefaultMaxDistance
+	}
+	for _, a := range words {
+		distance := editDistance(word, normalizeWord(a))
+		if distance < best {
+			best = distance
+			candidates = nil
+		}
+		if distance == best {
+			candidates = append(candidates, a)
+		}
+	}
+	return candidates
+}
+
+// ParseWord returns the byte of a single word at position, correcting it if it is not in the list. If the word was
+// corrected, the correction is returned too.
+func (r *Resolver) ParseWord(word string, position int) (byte, *Correction, error) {
+	if b, err := r.wordlist().ParseWord(word, position); err == nil {
+		return b, nil, nil
+	}
+	candidates := r.Suggest(word, position)
+	var resolved string
+	if r.Confirm != nil && len(candidates) != 0 {
+		var err error
+		resolved, err = r.Confirm(position, word, candidates)
+		if err != nil {
+			return 0, nil, err
+		}
+	} else if len(candidates) == 1 {
+		resolved = candidates[0]
+	} else {
+		return 0, nil, &WordError{Word: word, Position: position, Suggestions: candidates}
+	}
+	b, err := r.wordlist().ParseWord(resolved, position)
+	if err != nil {
+		return 0, nil, errors.New("invalid correction for word \"" + word + "\": " + err.Error())
+	}
+	return b, &Correction{Position: position, Word: word, Resolved: r.wordlist().Word(b, position)}, nil
+}
+
+// ParseBytes is like the ParseBytes function, but corrects words that are not in the list. Every correction is
+// returned, so they can be shown to the user.
+func (r *Resolver) ParseBytes(s string) ([]byte, []Correction, error) {
+	words := splitWords(s)
+	b := make([]byte, len(words))
+	var corrections []Correction
+	for i, a := range words {
+		var correction *Correction
+		var err error
+		b[i], correction, err = r.ParseWord(a, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		if correction != nil {
+			corrections = append(corrections, *correction)
+		}
+	}
+	return b, corrections, nil
+}
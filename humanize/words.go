@@ -3,29 +3,181 @@ package humanize
 import (
 	_ "embed"
 	"errors"
+	"os"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 //go:embed words.txt
 var words string
 
-var wordsArray []string
+//go:embed pgp_even.txt
+var pgpEvenWords string
 
-func GetWord(b byte) string {
-	if wordsArray == nil {
-		wordsArray = strings.Split(words, "\n")
+//go:embed pgp_odd.txt
+var pgpOddWords string
+
+// Wordlist maps every byte to a word. A list can use different words for bytes at even and odd positions, like the PGP
+// word list, so swapped or repeated words are detected.
+type Wordlist struct {
+	// words[0] is used at even positions, and words[1] at odd positions.
+	words [2][]string
+	// index maps every normalized word to its byte, for each of words.
+	index [2]map[string]byte
+}
+
+var (
+	// Default is the word list used by GetString and GetBytes, from words.txt.
+	Default = mustWordlist(strings.Split(words, "\n"), nil)
+	// PGP is the PGP word list, which uses two syllable words at even positions and three syllable words at odd
+	// positions.
+	PGP = mustWordlist(strings.Split(pgpEvenWords, "\n"), strings.Split(pgpOddWords, "\n"))
+)
+
+// Wordlists contains the built-in word lists by name.
+var Wordlists = map[string]*Wordlist{
+	"default": Default,
+	"pgp":     PGP,
+}
+
+// WordError is returned when a word is not in the word list.
+type WordError struct {
+	// The word as it was given.
+	Word string
+	// Index of the word, starting at 0.
+	Position int
+	// Words from the list that were probably meant, if any. Set by Resolver.
+	Suggestions []string
+}
+
+func (e *WordError) Error() string {
+	s := "unknown word \"" + e.Word + "\" at position " + strconv.Itoa(e.Position+1)
+	if len(e.Suggestions) != 0 {
+		s += ", did you mean " + strings.Join(e.Suggestions, ", ") + "?"
 	}
-	return wordsArray[b]
+	return s
 }
 
-func GetByte(s string) byte {
-	if wordsArray == nil {
-		wordsArray = strings.Split(words, "\n")
+// normalizeWord makes lookups ignore case.
+func normalizeWord(s string) string {
+	return strings.ToLower(s)
+}
+
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r)
+}
+
+// splitWords splits s into words, treating any whitespace or punctuation as a separator.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, isSeparator)
+}
+
+// newWordlist returns a Wordlist using even at even positions and odd at odd positions. If odd is nil, even is used
+// everywhere.
+func newWordlist(even, odd []string) (*Wordlist, error) {
+	shared := odd == nil
+	if shared {
+		odd = even
+	}
+	w := &Wordlist{words: [2][]string{even, odd}}
+	seen := make(map[string]bool)
+	for i, list := range w.words {
+		if len(list) != 256 {
+			return nil, errors.New("word list must contain 256 words, got " + strconv.Itoa(len(list)))
+		}
+		w.index[i] = make(map[string]byte, len(list))
+		for j, a := range list {
+			if a == "" || strings.IndexFunc(a, isSeparator) != -1 {
+				return nil, errors.New("invalid word \"" + a + "\" in word list")
+			}
+			word := normalizeWord(a)
+			// With separate lists, a word also can't be in both of them.
+			if _, ok := w.index[i][word]; ok || (!shared && i == 1 && seen[word]) {
+				return nil, errors.New("duplicate word \"" + a + "\" in word list")
+			}
+			w.index[i][word] = byte(j)
+			seen[word] = true
+		}
+	}
+	return w, nil
+}
+
+func mustWordlist(even, odd []string) *Wordlist {
+	w, err := newWordlist(even, odd)
+	if err != nil {
+		panic(err)
 	}
-	for i, a := range wordsArray {
-		if a == s {
-			return byte(i)
+	return w
+}
+
+// NewWordlist returns a Wordlist using words at every position. There must be exactly 256 unique words, which can't
+// contain whitespace or punctuation. No word can be the start of another word, so a unique prefix is never mistaken for
+// a different word.
+func NewWordlist(words []string) (*Wordlist, error) {
+	w, err := newWordlist(words, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range words {
+		for _, b := range words {
+			if a != b && strings.HasPrefix(normalizeWord(b), normalizeWord(a)) {
+				return nil, errors.New("word \"" + a + "\" is the start of \"" + b + "\" in word list")
+			}
+		}
+	}
+	return w, nil
+}
+
+// LoadWordlist reads a word list from the file at path, with one word on each line, and validates it like
+// NewWordlist. Empty lines are ignored.
+func LoadWordlist(path string) (*Wordlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			words = append(words, line)
 		}
 	}
-	panic(errors.New("unknown word: " + s))
+	w, err := NewWordlist(words)
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	return w, nil
+}
+
+// Word returns the word for b at position.
+func (w *Wordlist) Word(b byte, position int) string {
+	return w.words[position%2][b]
+}
+
+// ParseWord returns the byte of a single word at position, ignoring case.
+func (w *Wordlist) ParseWord(s string, position int) (byte, error) {
+	b, ok := w.index[position%2][normalizeWord(s)]
+	if !ok {
+		return 0, &WordError{Word: s, Position: position}
+	}
+	return b, nil
+}
+
+// GetWord returns the word for b in the Default word list.
+func GetWord(b byte) string {
+	return Default.Word(b, 0)
+}
+
+// ParseWord returns the byte of a single word in the Default word list, ignoring case.
+func ParseWord(s string) (byte, error) {
+	return Default.ParseWord(s, 0)
+}
+
+// GetByte is like ParseWord, but panics if the word is unknown.
+func GetByte(s string) byte {
+	b, err := ParseWord(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
 }
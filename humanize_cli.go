@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"os"
+	"strconv"
+)
+
+// loadWordlist returns the built-in word list called name, or reads one from the file at name.
+func loadWordlist(name string) (*humanize.Wordlist, error) {
+	if wordlist, ok := humanize.Wordlists[name]; ok {
+		return wordlist, nil
+	}
+	return humanize.LoadWordlist(name)
+}
+
+// parseWords parses humanized words with wordlist, printing every corrected word, and checks their checksum. If
+// interactive, the user is asked to confirm corrections. A size of 0 accepts data of any size, which must end with
+// checksum words.
+func (c *cli) parseWords(wordlist *humanize.Wordlist, interactive bool, s string, size int) ([]byte, bool, error) {
+	resolver := &humanize.Resolver{Wordlist: wordlist}
+	if interactive {
+		resolver.Confirm = wordConfirmer(wordlist)
+	}
+	words, corrections, err := resolver.ParseBytes(s)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, correction := range corrections {
+		fmt.Fprintln(c.stderr, "Corrected word "+strconv.Itoa(correction.Position+1)+" from \""+correction.Word+"\" to \""+correction.Resolved+"\"")
+	}
+	if size == 0 {
+		data, err := humanize.StripChecksum(words)
+		return data, err == nil, err
+	}
+	return humanize.CheckBytes(words, size)
+}
+
+// wordConfirmer returns a function for humanize.Resolver that asks which of the candidates was meant by an unknown
+// word.
+func wordConfirmer(wordlist *humanize.Wordlist) func(position int, word string, candidates []string) (string, error) {
+	return func(position int, word string, candidates []string) (string, error) {
+		fmt.Fprintln(os.Stderr, "Word "+strconv.Itoa(position+1)+" \""+word+"\" is not in the word list. Did you mean:")
+		for i, candidate := range candidates {
+			fmt.Fprintln(os.Stderr, "  "+strconv.Itoa(i+1)+") "+candidate)
+		}
+		for {
+			answer, err := readLine("Choose a number or type the word [1]: ")
+			if err != nil {
+				return "", err
+			}
+			if answer == "" {
+				return candidates[0], nil
+			}
+			if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(candidates) {
+				return candidates[i-1], nil
+			}
+			if _, err := wordlist.ParseWord(answer, position); err == nil {
+				return answer, nil
+			}
+		}
+	}
+}
@@ -1,274 +1,859 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"github.com/masquernya/go-encryption-program/encryption"
 	"github.com/masquernya/go-encryption-program/ferret"
 	"github.com/masquernya/go-encryption-program/humanize"
+	"github.com/masquernya/go-encryption-program/shamir"
+	"github.com/masquernya/go-encryption-program/vanity"
+	"io"
 	"os"
-	"runtime"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 )
 
-var commands = map[string]struct {
-	Arguments   []string
-	Description string
-}{
+var commands = map[string]command{
 	"help": {
-		Arguments:   []string{},
-		Description: "print this help message",
+		Arguments:   []string{"[<command>]"},
+		Description: "print this help message, or the flags of <command>",
+		MaxArgs:     1,
 	},
 	"encrypt-file": {
-		Arguments:   []string{"<publickey>", "<filepath>"},
-		Description: "encrypt file with public key, saving to <filepath>.enc",
+		Arguments:   []string{"<publickey>", "[<publickey>...]", "<filepath>"},
+		Description: "encrypt file with one or more public keys, saving to <outpath> (default <filepath>.enc). any of the matching private keys can decrypt it. an existing <outpath> is only replaced with --force. <filepath> and <outpath> can be - for stdin and stdout, and reading from stdin writes to stdout by default. with --metadata, the name, mode, modification time, size and content type of the file are encrypted too, so decrypt-file can restore them.",
+		Flags:       []string{"force", "metadata", "key-ids", "o"},
+		MinArgs:     2,
+		MaxArgs:     -1,
+		Run:         runEncryptFile,
 	},
 	"decrypt-file": {
 		Arguments:   []string{"<filepath>"},
-		Description: "decrypt file, saving to <filepath>.dec. private key is read from the PRIVATE_KEY environmental variable.",
+		Description: "decrypt file, saving to <outpath> (default <filepath>.dec). with --original-name, it is saved to the original name from the file's metadata in the same directory instead, which is never replaced if it exists, even with --force. the mode and modification time are restored from the metadata. an existing <outpath> is only replaced with --force. <filepath> and <outpath> can be - for stdin and stdout, and reading from stdin writes to stdout by default. nothing is saved if decryption fails. private key is read from the PRIVATE_KEY environmental variable, or from the key file in PRIVATE_KEY_FILE.",
+		Flags:       []string{"force", "original-name", "o"},
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runDecryptFile,
+	},
+	"encrypt-dir": {
+		Arguments:   []string{"<publickey>", "[<publickey>...]", "<dirpath>"},
+		Description: "encrypt a directory with one or more public keys like encrypt-file, saving it as a single archive to <outpath> (default <dirpath>.tar.enc). names, modes, modification times and symlinks are kept.",
+		Flags:       []string{"force", "key-ids", "o"},
+		MinArgs:     2,
+		MaxArgs:     -1,
+		Run:         runEncryptDir,
+	},
+	"decrypt-dir": {
+		Arguments:   []string{"<filepath>"},
+		Description: "decrypt an archive from encrypt-dir, extracting it to the directory <outpath> (default <filepath>.dec), which must not exist yet. private key is read from the PRIVATE_KEY environmental variable, or from the key file in PRIVATE_KEY_FILE.",
+		Flags:       []string{"o"},
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runDecryptDir,
+	},
+	"inspect-file": {
+		Arguments:   []string{"<filepath>"},
+		Description: "print the metadata of an encrypted file without decrypting its contents. private key is read from the PRIVATE_KEY environmental variable, or from the key file in PRIVATE_KEY_FILE.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runInspectFile,
+	},
+	"encrypt-file-auth": {
+		Arguments:   []string{"<publickey>", "[<publickey>...]", "<filepath>"},
+		Description: "encrypt file with one or more public keys like encrypt-file, authenticated as coming from you. your private key is read from the PRIVATE_KEY environmental variable, or from the key file in PRIVATE_KEY_FILE.",
+		Flags:       []string{"force", "metadata", "key-ids", "o"},
+		MinArgs:     2,
+		MaxArgs:     -1,
+		Run:         runEncryptFileAuth,
+	},
+	"decrypt-file-auth": {
+		Arguments:   []string{"<senderpublickey>", "<filepath>"},
+		Description: "decrypt file like decrypt-file, failing unless it was encrypted by the owner of <senderpublickey>.",
+		Flags:       []string{"force", "original-name", "o"},
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run:         runDecryptFileAuth,
 	},
 	"genkey": {
-		Arguments:   []string{},
 		Description: "generate public and private key, then print it to the terminal.",
+		Run:         runGenkey,
+	},
+	"genkey-file": {
+		Arguments:   []string{"<keyfile>"},
+		Description: "generate public and private key, saving the private key to <keyfile> encrypted with a passphrase. the public key is printed to the terminal.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runGenkeyFile,
+	},
+	"lock-key": {
+		Arguments:   []string{"<keyfile>"},
+		Description: "encrypt the private key from the PRIVATE_KEY environmental variable with a passphrase, saving it to <keyfile>.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runLockKey,
+	},
+	"unlock-key": {
+		Arguments:   []string{"<keyfile>"},
+		Description: "decrypt the private key in <keyfile> and print it to the terminal.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runUnlockKey,
+	},
+	"change-passphrase": {
+		Arguments:   []string{"<keyfile>"},
+		Description: "change the passphrase of the private key in <keyfile>.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runChangePassphrase,
+	},
+	"genkey-sign": {
+		Description: "generate an Ed25519 public and private key for signing, then print it to the terminal.",
+		Run:         runGenkeySign,
+	},
+	"sign-file": {
+		Arguments:   []string{"<filepath>"},
+		Description: "sign file, saving the detached signature to <filepath>.sig. signing key is read from the SIGNING_KEY environmental variable.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runSignFile,
+	},
+	"verify-file": {
+		Arguments:   []string{"<signingpublickey>", "<filepath>", "[<signaturepath>]"},
+		Description: "verify that the detached signature in <signaturepath> (default <filepath>.sig) was made for <filepath> by <signingpublickey>.",
+		MinArgs:     2,
+		MaxArgs:     3,
+		Run:         runVerifyFile,
 	},
 	"genkeyword": {
-		Arguments:   []string{"<mode>", "<case sensitive>", "<word>"},
-		Description: "generate public and private key with <word>, then print it to the terminal. <case sensitive> is true or false. <mode> is prefix or any",
+		Arguments:   []string{"<mode>", "<case sensitive>", "<word>", "[<word...>]"},
+		Description: "generate public and private key with <word> in the base64 public key, then print it to the terminal. <case sensitive> is true or false. <mode> is prefix, suffix, any, regex for a regular expression over the base64 public key, regex-words for a regular expression over the words of humanize-key, words for a key whose humanize-key words start with the words in <word>, or words-any for a key whose humanize-key words contain them. in the words modes, every <word> is part of a single sequence and <case sensitive> must be false. in the other modes, with more than one <word>, the first key matching any of them is printed. progress and the expected time are shown while searching. with --timeout, such as 10m or 2h, the search stops after that long. with --matches, the search keeps going until stopped, and every key found is appended to the file",
+		Flags:       []string{"timeout", "matches", "wordlist"},
+		MinArgs:     3,
+		MaxArgs:     -1,
+		Run:         runGenkeyword,
 	},
 	"decrypt-nacl": {
 		Arguments:   []string{"<message>"},
-		Description: "decrypt anonymous nacl box message (Base64 encoded) and print it to the terminal. private key is read from the PRIVATE_KEY environmental variable.",
+		Description: "decrypt anonymous nacl box message (Base64 encoded) and print it to the terminal. private key is read from the PRIVATE_KEY environmental variable, or from the key file in PRIVATE_KEY_FILE.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runDecryptNacl,
 	},
 	"encrypt-nacl": {
 		Arguments:   []string{"<publickey>", "<message>"},
 		Description: "encrypt message with public key and print it to the terminal (Base64 encoded)",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run:         runEncryptNacl,
+	},
+	"encrypt-nacl-auth": {
+		Arguments:   []string{"<publickey>", "<message>"},
+		Description: "encrypt message with public key like encrypt-nacl, authenticated as coming from you. your private key is read from the PRIVATE_KEY environmental variable, or from the key file in PRIVATE_KEY_FILE.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run:         runEncryptNaclAuth,
+	},
+	"decrypt-nacl-auth": {
+		Arguments:   []string{"<senderpublickey>", "<message>"},
+		Description: "decrypt message created by encrypt-nacl-auth, failing unless it was encrypted by the owner of <senderpublickey>.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run:         runDecryptNaclAuth,
 	},
 	"humanize-key": {
 		Arguments:   []string{"<publickey>"},
-		Description: "convert a base64 encoded public key to a string of words",
+		Description: "convert a base64 encoded public key to a string of words. the word list can be \"default\", \"pgp\" for the PGP word list, or a file with 256 words, one per line",
+		Flags:       []string{"wordlist"},
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runHumanizeKey,
+	},
+	"genkey-seed": {
+		Description: "generate a new public and private key from a random seed, and print the seed as a phrase of words that restore-key can rebuild the keys from",
+		Flags:       []string{"wordlist"},
+		Run:         runGenkeySeed,
+	},
+	"restore-key": {
+		Arguments:   []string{"<seed phrase>"},
+		Description: "rebuild the public and private key from a seed phrase printed by genkey-seed. words are corrected like dehumanize-key",
+		Flags:       []string{"interactive", "wordlist"},
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runRestoreKey,
+	},
+	"split-key": {
+		Arguments:   []string{"<shares>", "<threshold>"},
+		Description: "split the private key in the PRIVATE_KEY environmental variable, or from the key file in PRIVATE_KEY_FILE, into shares, any threshold of which can restore it with combine-key. with --words, every share is also printed as words",
+		Flags:       []string{"words", "wordlist"},
+		MinArgs:     2,
+		MaxArgs:     2,
+		Run:         runSplitKey,
+	},
+	"combine-key": {
+		Arguments:   []string{"<share>", "<share...>"},
+		Description: "restore a private key from shares created by split-key. each share can be base64 or words. fails if any share is corrupt or the shares don't belong together",
+		Flags:       []string{"interactive", "wordlist"},
+		MinArgs:     1,
+		MaxArgs:     -1,
+		Run:         runCombineKey,
 	},
 	"dehumanize-key": {
 		Arguments:   []string{"<key>"},
-		Description: "convert a string of words generated by humanize-key to a base64 encoded public key",
+		Description: "convert a string of words generated by humanize-key to a base64 encoded public key. the two checksum words at the end detect typos, and usually point to the wrong word. misspelled words and unique prefixes of words are corrected when there is only one likely word. with --interactive, you are asked to confirm every corrected word. the word list must match the one used by humanize-key. data that is not a 32 byte key needs --size",
+		Flags:       []string{"interactive", "wordlist", "size"},
+		MinArgs:     1,
+		MaxArgs:     1,
+		Run:         runDehumanizeKey,
 	},
 }
 
-func printHelp() {
-	fmt.Println("OwO1 Encryption Standard. Essentially NaCL box with chunk support.")
-	fmt.Println("Commands:")
-	for cmd, data := range commands {
-		fmt.Print("\n")
-		fmt.Println("" + cmd + " " + strings.Join(data.Arguments, " "))
-		fmt.Println("    " + data.Description)
+// decodeArg decodes the Base64 argument described by name, such as "public key". An invalid argument is a usage error.
+func decodeArg(name string, arg string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(arg)
+	if err != nil {
+		return nil, newUsageError("invalid " + name + " \"" + arg + "\": " + err.Error())
 	}
-	os.Exit(0)
+	return data, nil
 }
 
-func main() {
-	if len(os.Args) < 2 || os.Args[1] == "help" {
-		printHelp()
-	}
-
-	if os.Args[1] == "genkey" {
-		publicKey, privateKey, err := encryption.GenerateKeys()
+// decodePublicKeys decodes every Base64 public key in args.
+func decodePublicKeys(args []string) ([][]byte, error) {
+	var publicKeys [][]byte
+	for _, arg := range args {
+		publicKey, err := decodeArg("public key", arg)
 		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-		fmt.Println("Public Key (Base64):")
-		fmt.Println(base64.StdEncoding.EncodeToString(publicKey))
-		fmt.Println("Private Key (Base64):")
-		fmt.Println(base64.StdEncoding.EncodeToString(privateKey))
-		os.Exit(0)
-	} else if os.Args[1] == "genkeyword" {
-		if len(os.Args) < 5 {
-			printHelp()
+			return nil, err
 		}
-		mode := os.Args[2]
-		caseSensitive, err := strconv.ParseBool(os.Args[3])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-		prefix := os.Args[4]
-		if !caseSensitive {
-			prefix = strings.ToLower(prefix)
-		}
-		ch := make(chan [][]byte)
-		//var attempts int64 = 0
-		//var attemptsMux sync.Mutex
-		start := time.Now()
-		threadCount := runtime.NumCPU()
-		for i := 0; i < threadCount; i++ {
-			go (func() {
-				var myPublicKey []byte
-				var myPrivateKey []byte
-				var err error
-				for {
-					myPublicKey, myPrivateKey, err = encryption.GenerateKeys()
-					if err != nil {
-						fmt.Println(err)
-						os.Exit(1)
-					}
-
-					if mode == "prefix" {
-						kb64 := base64.StdEncoding.EncodeToString(myPublicKey[0:len(prefix)])
-						if !caseSensitive {
-							kb64 = strings.ToLower(kb64)
-						}
-
-						if strings.HasPrefix(kb64, prefix) {
-							fmt.Println("took", time.Since(start))
-							s := strings.Repeat("^", len(prefix))
-							ch <- [][]byte{myPublicKey, myPrivateKey, []byte(s)}
-						}
-					} else if mode == "suffix" {
-						kb64 := base64.StdEncoding.EncodeToString(myPublicKey)
-						if !caseSensitive {
-							kb64 = strings.ToLower(kb64)
-						}
-
-						for strings.HasSuffix(kb64, "=") {
-							kb64 = kb64[:len(kb64)-1]
-						}
-						if strings.HasSuffix(kb64, prefix) {
-							fmt.Println("took", time.Since(start))
-							s := strings.Repeat(" ", len(kb64)-len(prefix))
-							s += strings.Repeat("^", len(prefix))
-							ch <- [][]byte{myPublicKey, myPrivateKey, []byte(s)}
-						}
-					} else if mode == "any" {
-						kb64 := base64.StdEncoding.EncodeToString(myPublicKey)
-						if !caseSensitive {
-							kb64 = strings.ToLower(kb64)
-						}
-						pos := strings.Index(kb64, prefix)
-						if pos != -1 {
-							strLocation := strings.Repeat(" ", pos)
-							strLocation += strings.Repeat("^", utf8.RuneCountInString(prefix))
-							fmt.Println("took", time.Since(start))
-							ch <- [][]byte{myPublicKey, myPrivateKey, []byte(strLocation)}
-							break
-						}
-					} else {
-						panic("invalid mode")
-					}
-				}
-			})()
-		}
-		keys := <-ch
-		fmt.Println("Public Key (Base64):")
-		fmt.Println(base64.StdEncoding.EncodeToString(keys[0]))
-		fmt.Println(string(keys[2]))
-		fmt.Println("Private Key (Base64):")
-		fmt.Println(base64.StdEncoding.EncodeToString(keys[1]))
-		os.Exit(0)
-	} else if os.Args[1] == "encrypt-file" {
-		if len(os.Args) < 4 {
-			printHelp()
+		publicKeys = append(publicKeys, publicKey)
+	}
+	return publicKeys, nil
+}
+
+// encryptedFilePath returns where encrypt-file saves inFilePath by default: <inFilePath>.enc, or stdout when reading
+// from stdin.
+func encryptedFilePath(inFilePath string) string {
+	if inFilePath == ferret.StdioPath {
+		return ferret.StdioPath
+	}
+	return inFilePath + ".enc"
+}
+
+// decryptedFilePath returns where decrypt-file saves inFilePath by default: <inFilePath>.dec, or with originalName, the
+// original name from its metadata in the same directory. When reading from stdin, it is stdout. It also returns whether
+// the name is from the metadata, which anyone with the public key could have chosen.
+func decryptedFilePath(inFilePath string, privateKey []byte, originalName bool) (string, bool) {
+	if inFilePath == ferret.StdioPath {
+		return ferret.StdioPath, false
+	}
+	if !originalName {
+		return inFilePath + ".dec", false
+	}
+	// Errors are reported when decrypting.
+	metadata, err := ferret.ReadMetadata(inFilePath, privateKey)
+	if err != nil || metadata == nil {
+		return inFilePath + ".dec", false
+	}
+	// Only use plain names, so the file can't be saved to another directory.
+	name := metadata.Name
+	if !filepath.IsLocal(name) || filepath.Base(name) != name {
+		return inFilePath + ".dec", false
+	}
+	return filepath.Join(filepath.Dir(inFilePath), name), true
+}
+
+// statusOutput returns where to print messages for a command writing to outPath, which is stderr when the output
+// goes to stdout.
+func (c *cli) statusOutput(outPath string) io.Writer {
+	if outPath == ferret.StdioPath {
+		return c.stderr
+	}
+	return c.stdout
+}
+
+// savedTo describes where a command wrote its output.
+func savedTo(outPath string) string {
+	if outPath == ferret.StdioPath {
+		return "written to stdout"
+	}
+	return "saved to " + outPath
+}
+
+// fileError explains an error from writing outPath.
+func fileError(err error, outPath string) error {
+	if os.IsExist(err) {
+		return &existsError{Path: outPath, Force: true}
+	}
+	return err
+}
+
+func runGenkey(c *cli, o *options, args []string) error {
+	publicKey, privateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		return err
+	}
+	c.print(newKeyOutput(publicKey, privateKey, o.wordlist))
+	return nil
+}
+
+func runGenkeyFile(c *cli, o *options, args []string) error {
+	_, privateKey, err := encryption.GenerateKeys()
+	if err != nil {
+		return err
+	}
+	return c.lockKey(o, args[0], privateKey)
+}
+
+func runLockKey(c *cli, o *options, args []string) error {
+	privateKey, err := readKeyEnv("PRIVATE_KEY")
+	if err != nil {
+		return err
+	}
+	return c.lockKey(o, args[0], privateKey)
+}
+
+// lockKey saves privateKey to keyFilePath, encrypted with a new passphrase.
+func (c *cli) lockKey(o *options, keyFilePath string, privateKey []byte) error {
+	if _, err := os.Stat(keyFilePath); err == nil {
+		return &existsError{Path: keyFilePath}
+	}
+	publicKey, err := encryption.GetPublicKey(privateKey)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readNewPassphrase()
+	if err != nil {
+		return err
+	}
+	if err := encryption.SavePrivateKey(keyFilePath, privateKey, passphrase); err != nil {
+		return err
+	}
+	c.print(keyFileOutput{KeyFile: keyFilePath, keyOutput: newKeyOutput(publicKey, nil, o.wordlist)})
+	return nil
+}
+
+func runUnlockKey(c *cli, o *options, args []string) error {
+	privateKey, err := unlockPrivateKey(args[0])
+	if err != nil {
+		return err
+	}
+	publicKey, err := encryption.GetPublicKey(privateKey)
+	if err != nil {
+		return err
+	}
+	c.print(newKeyOutput(publicKey, privateKey, o.wordlist))
+	return nil
+}
+
+func runChangePassphrase(c *cli, o *options, args []string) error {
+	keyFilePath := args[0]
+	privateKey, err := unlockPrivateKey(keyFilePath)
+	if err != nil {
+		return err
+	}
+	passphrase, err := readNewPassphrase()
+	if err != nil {
+		return err
+	}
+	if err := encryption.SavePrivateKey(keyFilePath, privateKey, passphrase); err != nil {
+		return err
+	}
+	c.print(passphraseOutput{KeyFile: keyFilePath})
+	return nil
+}
+
+func runGenkeySign(c *cli, o *options, args []string) error {
+	publicKey, privateKey, err := encryption.GenerateSigningKeys()
+	if err != nil {
+		return err
+	}
+	c.print(signingKeyOutput{
+		SigningPublicKey:  base64.StdEncoding.EncodeToString(publicKey),
+		SigningPrivateKey: base64.StdEncoding.EncodeToString(privateKey),
+	})
+	return nil
+}
+
+func runSignFile(c *cli, o *options, args []string) error {
+	signingKey, err := readKeyEnv("SIGNING_KEY")
+	if err != nil {
+		return err
+	}
+	inFilePath := args[0]
+	signatureFilePath := inFilePath + ".sig"
+	if err := ferret.SignFile(inFilePath, signatureFilePath, signingKey); err != nil {
+		return err
+	}
+	c.print(signatureOutput{File: inFilePath, SignatureFile: signatureFilePath})
+	return nil
+}
+
+func runVerifyFile(c *cli, o *options, args []string) error {
+	publicKey, err := decodeArg("signing public key", args[0])
+	if err != nil {
+		return err
+	}
+	inFilePath := args[1]
+	signatureFilePath := inFilePath + ".sig"
+	if len(args) > 2 {
+		signatureFilePath = args[2]
+	}
+	if err := ferret.VerifyFile(inFilePath, signatureFilePath, publicKey); err != nil {
+		return err
+	}
+	c.print(signatureOutput{File: inFilePath, SignatureFile: signatureFilePath, Verified: true})
+	return nil
+}
+
+// newVanityKeyOutput returns the vanityKeyOutput of a key found by genkeyword.
+func newVanityKeyOutput(result vanity.Result, matchers []vanity.Matcher, patterns []string, wordlist *humanize.Wordlist) vanityKeyOutput {
+	output := vanityKeyOutput{
+		elapsed:        result.Elapsed,
+		Pattern:        patterns[result.Matcher],
+		MatchStart:     -1,
+		MatchEnd:       -1,
+		ElapsedSeconds: result.Elapsed.Seconds(),
+		keyOutput:      newKeyOutput(result.PublicKey, result.PrivateKey, wordlist),
+	}
+	if locator, ok := matchers[result.Matcher].(vanity.Locator); ok {
+		output.MatchStart, output.MatchEnd = locator.Locate(result.PublicKey)
+	}
+	return output
+}
+
+func runGenkeyword(c *cli, o *options, args []string) error {
+	// Stop cleanly on ctrl+c.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if o.timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	caseSensitive, err := strconv.ParseBool(args[1])
+	if err != nil {
+		return newUsageError("invalid <case sensitive> \"" + args[1] + "\", must be true or false")
+	}
+	patterns := args[2:]
+	if args[0] == "words" || args[0] == "words-any" {
+		if caseSensitive {
+			return newUsageError("<case sensitive> must be false in the " + args[0] + " mode, words are not case sensitive")
 		}
-		publicKey, err := base64.StdEncoding.DecodeString(os.Args[2])
+		// The words are a single sequence, whether or not they were quoted.
+		patterns = []string{strings.Join(patterns, " ")}
+	}
+	var matchers []vanity.Matcher
+	for _, pattern := range patterns {
+		matcher, err := newVanityMatcher(args[0], pattern, caseSensitive, o.wordlist)
 		if err != nil {
-			panic(err)
+			return newUsageError(err.Error())
 		}
-		inFilePath := os.Args[3]
-		outFilePath := inFilePath + ".enc"
-		err = ferret.EncryptFile(inFilePath, outFilePath, publicKey)
+		matchers = append(matchers, matcher)
+	}
+	search := &vanity.Search{Matchers: matchers, Progress: c.newProgressPrinter()}
+	output := vanityOutput{MatchesFile: o.matches, Keys: []vanityKeyOutput{}}
+	if probability := search.Probability(); probability > 0 {
+		output.ExpectedAttempts = 1 / probability
+	}
+	var matchesErr error
+	if o.matches != "" {
+		// The file contains private keys.
+		matchesFile, err := os.OpenFile(o.matches, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		fmt.Println("File encrypted and saved to " + outFilePath)
-	} else if os.Args[1] == "decrypt-file" {
-		if len(os.Args) < 3 {
-			printHelp()
+		defer matchesFile.Close()
+		// Keep searching until stopped, saving every match.
+		search.Found = func(result vanity.Result) bool {
+			key := newVanityKeyOutput(result, matchers, patterns, o.wordlist)
+			if !c.json {
+				c.clearProgress()
+				key.printText(c)
+			}
+			if _, err := fmt.Fprintln(matchesFile, key.PublicKey+" "+key.PrivateKey+" "+key.Pattern); err != nil {
+				matchesErr = err
+				return false
+			}
+			output.Keys = append(output.Keys, key)
+			return true
 		}
-		privateKeyStr, privateKeyExists := os.LookupEnv("PRIVATE_KEY")
-		if !privateKeyExists {
-			fmt.Println("Environment variable PRIVATE_KEY not found")
-			os.Exit(1)
-		}
-		privateKey, err := base64.StdEncoding.DecodeString(privateKeyStr)
-		if err != nil {
-			panic(err)
+	}
+	c.printSearchDifficulty(search)
+	result, err := search.Run(ctx)
+	c.clearProgress()
+	output.Attempts = result.Attempts
+	output.ElapsedSeconds = result.Elapsed.Seconds()
+	if matchesErr != nil {
+		return matchesErr
+	}
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		if len(output.Keys) > 0 {
+			c.print(output)
+			return nil
 		}
+		// Still report the attempts.
+		c.result = output
+		return &noMatchError{Attempts: result.Attempts, Elapsed: result.Elapsed}
+	} else if err != nil {
+		return err
+	}
+	output.Keys = append(output.Keys, newVanityKeyOutput(result, matchers, patterns, o.wordlist))
+	c.print(output)
+	return nil
+}
 
-		inFilePath := os.Args[2]
-		outFilePath := inFilePath + ".dec"
+func runEncryptFile(c *cli, o *options, args []string) error {
+	return c.encryptFile(o, args, nil)
+}
 
-		err = ferret.DecryptFile(inFilePath, outFilePath, privateKey)
-		if err != nil {
-			panic(err)
-		}
-		fmt.Println("File decrypted and saved to " + outFilePath)
-	} else if os.Args[1] == "encrypt-nacl" {
-		if len(os.Args) < 3 {
-			printHelp()
-		}
-		publicKey, err := base64.StdEncoding.DecodeString(os.Args[2])
-		if err != nil {
-			panic(err)
-		}
-		message := os.Args[3]
+func runEncryptFileAuth(c *cli, o *options, args []string) error {
+	senderPrivateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	return c.encryptFile(o, args, senderPrivateKey)
+}
 
-		encrypted, err := encryption.PublicKeyEncrypt(publicKey, []byte(message))
+// encryptFile encrypts the file in the last argument for the public keys in the other arguments, authenticated with
+// senderPrivateKey if it is set.
+func (c *cli) encryptFile(o *options, args []string, senderPrivateKey []byte) error {
+	// Every argument except the last one is a public key.
+	publicKeys, err := decodePublicKeys(args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+	inFilePath := args[len(args)-1]
+	output := fileOutput{kind: "File", encrypted: true, Input: inFilePath, Output: o.out, Recipients: fingerprints(publicKeys)}
+	if output.Output == "" {
+		output.Output = encryptedFilePath(inFilePath)
+	}
+	c.dataOnStdout = output.Output == ferret.StdioPath
+	if o.metadata && inFilePath == ferret.StdioPath {
+		return newUsageError("--metadata needs a file, not stdin")
+	}
+	if senderPrivateKey != nil {
+		senderPublicKey, err := encryption.GetPublicKey(senderPrivateKey)
 		if err != nil {
-			panic(err)
+			return err
 		}
-		fmt.Println("Encrypted message (Base64):")
-		fmt.Println(base64.StdEncoding.EncodeToString(encrypted))
+		output.SenderPublicKey = base64.StdEncoding.EncodeToString(senderPublicKey)
+	}
+	start := time.Now()
+	options := ferret.EncryptFileOptions{EncryptOptions: encryption.EncryptOptions{SenderPrivateKey: senderPrivateKey, IncludeKeyIds: o.keyIds}, Force: o.force, IncludeMetadata: o.metadata}
+	if err := ferret.EncryptFileWithOptions(inFilePath, output.Output, publicKeys, options); err != nil {
+		return fileError(err, output.Output)
+	}
+	output.ElapsedSeconds = time.Since(start).Seconds()
+	output.InputBytes, output.OutputBytes = fileSize(inFilePath), fileSize(output.Output)
+	c.print(output)
+	return nil
+}
 
-	} else if os.Args[1] == "decrypt-nacl" {
-		if len(os.Args) < 3 {
-			printHelp()
-		}
-		privateKeyStr, privateKeyExists := os.LookupEnv("PRIVATE_KEY")
-		if !privateKeyExists {
-			fmt.Println("Environment variable PRIVATE_KEY not found")
-			os.Exit(1)
-		}
-		privateKey, err := base64.StdEncoding.DecodeString(privateKeyStr)
-		if err != nil {
-			panic(err)
-		}
+func runDecryptFile(c *cli, o *options, args []string) error {
+	return c.decryptFile(o, args[0], nil)
+}
 
-		message, err := base64.StdEncoding.DecodeString(os.Args[2])
-		if err != nil {
-			panic(err)
-		}
+func runDecryptFileAuth(c *cli, o *options, args []string) error {
+	senderPublicKey, err := decodeArg("sender public key", args[0])
+	if err != nil {
+		return err
+	}
+	return c.decryptFile(o, args[1], senderPublicKey)
+}
 
-		decrypted, err := encryption.PublicKeyDecrypt(privateKey, message)
-		if err != nil {
-			panic(err)
+// decryptFile decrypts inFilePath, failing unless it was authenticated by senderPublicKey if it is set.
+func (c *cli) decryptFile(o *options, inFilePath string, senderPublicKey []byte) error {
+	c.dataOnStdout = o.out == ferret.StdioPath || (o.out == "" && inFilePath == ferret.StdioPath)
+	privateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	output := fileOutput{kind: "File", Input: inFilePath, Output: o.out}
+	// A name from the metadata never replaces a file, so the sender can't choose which file is overwritten.
+	fromMetadata := false
+	if output.Output == "" {
+		output.Output, fromMetadata = decryptedFilePath(inFilePath, privateKey, o.originalName)
+	}
+	if senderPublicKey != nil {
+		output.SenderPublicKey = base64.StdEncoding.EncodeToString(senderPublicKey)
+	}
+	start := time.Now()
+	options := ferret.DecryptFileOptions{DecryptOptions: encryption.DecryptOptions{SenderPublicKey: senderPublicKey}, Force: o.force && !fromMetadata, RestoreMetadata: true}
+	if err := ferret.DecryptFileWithOptions(inFilePath, output.Output, privateKey, options); err != nil {
+		if fromMetadata && os.IsExist(err) {
+			return &existsError{Path: output.Output}
 		}
+		return fileError(err, output.Output)
+	}
+	output.ElapsedSeconds = time.Since(start).Seconds()
+	output.InputBytes, output.OutputBytes = fileSize(inFilePath), fileSize(output.Output)
+	c.print(output)
+	return nil
+}
+
+func runInspectFile(c *cli, o *options, args []string) error {
+	privateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	metadata, err := ferret.ReadMetadata(args[0], privateKey)
+	if err != nil {
+		return err
+	}
+	c.print(newInspectOutput(args[0], metadata))
+	return nil
+}
+
+func runEncryptDir(c *cli, o *options, args []string) error {
+	// Every argument except the last one is a public key.
+	publicKeys, err := decodePublicKeys(args[:len(args)-1])
+	if err != nil {
+		return err
+	}
+	dirPath := filepath.Clean(args[len(args)-1])
+	output := fileOutput{kind: "Directory", encrypted: true, Input: dirPath, Output: o.out, Recipients: fingerprints(publicKeys)}
+	if output.Output == "" {
+		output.Output = dirPath + ".tar.enc"
+	}
+	c.dataOnStdout = output.Output == ferret.StdioPath
+	start := time.Now()
+	options := ferret.EncryptFileOptions{EncryptOptions: encryption.EncryptOptions{IncludeKeyIds: o.keyIds}, Force: o.force}
+	if err := ferret.EncryptDirWithOptions(dirPath, output.Output, publicKeys, options); err != nil {
+		return fileError(err, output.Output)
+	}
+	output.ElapsedSeconds = time.Since(start).Seconds()
+	output.OutputBytes = fileSize(output.Output)
+	c.print(output)
+	return nil
+}
 
-		ok := utf8.Valid(decrypted)
-		if !ok {
-			fmt.Println("Message (Base64):")
-			fmt.Println(base64.StdEncoding.EncodeToString(decrypted))
-			os.Exit(0)
+func runDecryptDir(c *cli, o *options, args []string) error {
+	inFilePath := args[0]
+	output := fileOutput{kind: "Directory", Input: inFilePath, Output: o.out}
+	if output.Output == "" && inFilePath == ferret.StdioPath {
+		return newUsageError("-o <outpath> is needed when reading from stdin")
+	}
+	if output.Output == "" {
+		output.Output = inFilePath + ".dec"
+	}
+	if output.Output == ferret.StdioPath {
+		return newUsageError("a directory cannot be written to stdout")
+	}
+	privateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	if err := ferret.DecryptDir(inFilePath, output.Output, privateKey); err != nil {
+		if os.IsExist(err) {
+			return &existsError{Path: output.Output}
 		}
-		fmt.Println(string(decrypted))
-	} else if os.Args[1] == "humanize-key" {
-		if len(os.Args) < 3 {
-			printHelp()
+		return err
+	}
+	output.ElapsedSeconds = time.Since(start).Seconds()
+	output.InputBytes = fileSize(inFilePath)
+	c.print(output)
+	return nil
+}
+
+func runEncryptNacl(c *cli, o *options, args []string) error {
+	publicKey, err := decodeArg("public key", args[0])
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryption.PublicKeyEncrypt(publicKey, []byte(args[1]))
+	if err != nil {
+		return err
+	}
+	c.print(encryptedMessageOutput{Message: base64.StdEncoding.EncodeToString(encrypted)})
+	return nil
+}
+
+func runDecryptNacl(c *cli, o *options, args []string) error {
+	message, err := decodeArg("message", args[0])
+	if err != nil {
+		return err
+	}
+	privateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	decrypted, err := encryption.PublicKeyDecrypt(privateKey, message)
+	if err != nil {
+		return err
+	}
+	c.print(newMessageOutput(decrypted, nil))
+	return nil
+}
+
+func runEncryptNaclAuth(c *cli, o *options, args []string) error {
+	publicKey, err := decodeArg("public key", args[0])
+	if err != nil {
+		return err
+	}
+	senderPrivateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryption.AuthenticatedEncrypt(senderPrivateKey, publicKey, []byte(args[1]))
+	if err != nil {
+		return err
+	}
+	c.print(encryptedMessageOutput{Message: base64.StdEncoding.EncodeToString(encrypted)})
+	return nil
+}
+
+func runDecryptNaclAuth(c *cli, o *options, args []string) error {
+	expectedSender, err := decodeArg("sender public key", args[0])
+	if err != nil {
+		return err
+	}
+	message, err := decodeArg("message", args[1])
+	if err != nil {
+		return err
+	}
+	privateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	decrypted, sender, err := encryption.AuthenticatedDecrypt(privateKey, message)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sender, expectedSender) {
+		return &wrongSenderError{Sender: sender}
+	}
+	c.print(newMessageOutput(decrypted, sender))
+	return nil
+}
+
+func runHumanizeKey(c *cli, o *options, args []string) error {
+	key, err := decodeArg("key", args[0])
+	if err != nil {
+		return err
+	}
+	c.print(humanizedOutput{
+		Key:         base64.StdEncoding.EncodeToString(key),
+		Humanized:   humanized(o.wordlist, key),
+		Fingerprint: encryption.Fingerprint(key),
+		Checked:     true,
+	})
+	return nil
+}
+
+func runDehumanizeKey(c *cli, o *options, args []string) error {
+	if o.size < 0 {
+		return newUsageError("invalid --size " + strconv.Itoa(o.size) + ", must be 0 or more")
+	}
+	key, checked, err := c.parseWords(o.wordlist, o.interactive, args[0], o.size)
+	if err != nil {
+		return err
+	}
+	if !checked {
+		fmt.Fprintln(c.stderr, "Warning: the humanized key has no checksum words, so typos can't be detected. Make sure it is correct.")
+	}
+	c.print(humanizedOutput{
+		dehumanized: true,
+		Key:         base64.StdEncoding.EncodeToString(key),
+		Humanized:   humanized(o.wordlist, key),
+		Fingerprint: encryption.Fingerprint(key),
+		Checked:     checked,
+	})
+	return nil
+}
+
+func runGenkeySeed(c *cli, o *options, args []string) error {
+	seed, err := encryption.GenerateSeed()
+	if err != nil {
+		return err
+	}
+	publicKey, privateKey, err := encryption.KeysFromSeed(seed)
+	if err != nil {
+		return err
+	}
+	c.print(seedOutput{SeedPhrase: humanized(o.wordlist, seed), keyOutput: newKeyOutput(publicKey, privateKey, o.wordlist)})
+	return nil
+}
+
+func runRestoreKey(c *cli, o *options, args []string) error {
+	seed, checked, err := c.parseWords(o.wordlist, o.interactive, args[0], encryption.SeedSize)
+	if err != nil {
+		return err
+	}
+	if !checked {
+		return errMissingChecksum
+	}
+	publicKey, privateKey, err := encryption.KeysFromSeed(seed)
+	if err != nil {
+		return err
+	}
+	c.print(newKeyOutput(publicKey, privateKey, o.wordlist))
+	return nil
+}
+
+func runSplitKey(c *cli, o *options, args []string) error {
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return newUsageError("invalid <shares> \"" + args[0] + "\", must be a number")
+	}
+	threshold, err := strconv.Atoi(args[1])
+	if err != nil {
+		return newUsageError("invalid <threshold> \"" + args[1] + "\", must be a number")
+	}
+	privateKey, err := readPrivateKey()
+	if err != nil {
+		return err
+	}
+	publicKey, err := encryption.GetPublicKey(privateKey)
+	if err != nil {
+		return err
+	}
+	shares, err := shamir.Split(privateKey, n, threshold)
+	if err != nil {
+		return err
+	}
+	output := splitOutput{words: o.words, Fingerprint: encryption.Fingerprint(publicKey), Threshold: threshold}
+	for _, share := range shares {
+		output.Shares = append(output.Shares, shareOutput{
+			Index: int(share.Index),
+			Share: base64.StdEncoding.EncodeToString(share.Bytes()),
+			Words: humanized(o.wordlist, share.Bytes()),
+		})
+	}
+	c.print(output)
+	return nil
+}
+
+func runCombineKey(c *cli, o *options, args []string) error {
+	var shares []shamir.Share
+	for i, arg := range args {
+		// Shares are either Base64 or words, which contain spaces.
+		data, err := base64.StdEncoding.DecodeString(arg)
+		if err != nil {
+			data, _, err = c.parseWords(o.wordlist, o.interactive, arg, shamir.EncodedSize(32))
 		}
-		key, err := base64.StdEncoding.DecodeString(os.Args[2])
 		if err != nil {
-			panic(err)
+			return &shareError{Position: i, Err: err}
 		}
-		fmt.Println("Humanized key:")
-		fmt.Println(humanize.GetString(key))
-	} else if os.Args[1] == "dehumanize-key" {
-		if len(os.Args) < 3 {
-			printHelp()
+		share, err := shamir.ParseShare(data)
+		if err != nil {
+			return &shareError{Position: i, Err: err}
 		}
-		key := os.Args[2]
-		fmt.Println("Dehumanized key (Base64):")
-		fmt.Println(base64.StdEncoding.EncodeToString(humanize.GetBytes(key)))
-	} else {
-		printHelp()
+		shares = append(shares, share)
+	}
+	privateKey, err := shamir.Combine(shares)
+	if err != nil {
+		return err
+	}
+	publicKey, err := encryption.GetPublicKey(privateKey)
+	if err != nil {
+		return err
 	}
+	c.print(newKeyOutput(publicKey, privateKey, o.wordlist))
+	return nil
 }
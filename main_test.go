@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// unsetEnv removes the environmental variable called name for the duration of the test.
+func unsetEnv(t *testing.T, name string) {
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+// runCommand runs args and returns the exit code and output.
+func runCommand(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommandValidation(t *testing.T) {
+	unsetEnv(t, "PRIVATE_KEY")
+	unsetEnv(t, "PRIVATE_KEY_FILE")
+	unsetEnv(t, "SIGNING_KEY")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, _, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(publicKey)
+
+	tests := []struct {
+		args []string
+		code int
+		// Expected in stderr.
+		message string
+	}{
+		{[]string{}, exitUsage, "Commands:"},
+		{[]string{"nope"}, exitUsage, "unknown command \"nope\""},
+		{[]string{"help", "nope"}, exitUsage, "unknown command \"nope\""},
+		{[]string{"help", "genkey", "genkey"}, exitUsage, "expected at most 1 argument, got 2"},
+
+		{[]string{"encrypt-file", file}, exitUsage, "expected at least 2 arguments, got 1"},
+		{[]string{"encrypt-file", "not base64!", file}, exitUsage, "invalid public key \"not base64!\""},
+		{[]string{"encrypt-file", "--bogus", key, file}, exitUsage, "flag provided but not defined: -bogus"},
+		{[]string{"encrypt-file", "-o"}, exitUsage, "flag needs an argument: -o"},
+		{[]string{"encrypt-file", "--metadata", key, "-"}, exitUsage, "--metadata needs a file, not stdin"},
+		{[]string{"encrypt-file", "--force=maybe", key, file}, exitUsage, "invalid boolean value \"maybe\" for -force"},
+		{[]string{"encrypt-file", key, filepath.Join(dir, "missing")}, exitError, "no such file or directory"},
+		{[]string{"decrypt-file"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"decrypt-file", file, file}, exitUsage, "expected 1 argument, got 2"},
+		{[]string{"decrypt-file", "--metadata", file}, exitUsage, "flag provided but not defined: -metadata"},
+		{[]string{"decrypt-file", file}, exitError, "PRIVATE_KEY or PRIVATE_KEY_FILE not found"},
+		{[]string{"encrypt-dir", dir}, exitUsage, "expected at least 2 arguments, got 1"},
+		{[]string{"encrypt-dir", "AAA", dir}, exitUsage, "invalid public key \"AAA\""},
+		{[]string{"decrypt-dir"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"decrypt-dir", "-"}, exitUsage, "-o <outpath> is needed when reading from stdin"},
+		{[]string{"decrypt-dir", "-o", "-", file}, exitUsage, "a directory cannot be written to stdout"},
+		{[]string{"decrypt-dir", "--force", file}, exitUsage, "flag provided but not defined: -force"},
+		{[]string{"inspect-file"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"inspect-file", file}, exitError, "PRIVATE_KEY or PRIVATE_KEY_FILE not found"},
+		{[]string{"encrypt-file-auth", file}, exitUsage, "expected at least 2 arguments, got 1"},
+		{[]string{"encrypt-file-auth", key, file}, exitError, "PRIVATE_KEY or PRIVATE_KEY_FILE not found"},
+		{[]string{"decrypt-file-auth", file}, exitUsage, "expected 2 arguments, got 1"},
+		{[]string{"decrypt-file-auth", "AAA", file}, exitUsage, "invalid sender public key \"AAA\""},
+
+		{[]string{"genkey", "extra"}, exitUsage, "expected 0 arguments, got 1"},
+		{[]string{"genkey-file"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"genkey-file", file}, exitError, file + " already exists"},
+		{[]string{"lock-key"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"lock-key", filepath.Join(dir, "key")}, exitError, "Environment variable PRIVATE_KEY not found"},
+		{[]string{"unlock-key"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"unlock-key", filepath.Join(dir, "missing")}, exitError, "no such file or directory"},
+		{[]string{"change-passphrase", "a", "b"}, exitUsage, "expected 1 argument, got 2"},
+		{[]string{"genkey-sign", "extra"}, exitUsage, "expected 0 arguments, got 1"},
+		{[]string{"sign-file"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"sign-file", file}, exitError, "Environment variable SIGNING_KEY not found"},
+		{[]string{"verify-file", key}, exitUsage, "expected between 2 and 3 arguments, got 1"},
+		{[]string{"verify-file", key, file, file, file}, exitUsage, "expected between 2 and 3 arguments, got 4"},
+		{[]string{"verify-file", "AAA", file}, exitUsage, "invalid signing public key \"AAA\""},
+
+		{[]string{"genkeyword", "prefix", "true"}, exitUsage, "expected at least 3 arguments, got 2"},
+		{[]string{"genkeyword", "prefix", "maybe", "abc"}, exitUsage, "invalid <case sensitive> \"maybe\""},
+		{[]string{"genkeyword", "middle", "true", "abc"}, exitUsage, "invalid mode \"middle\""},
+		{[]string{"genkeyword", "prefix", "true", "a!"}, exitUsage, "a!"},
+		{[]string{"genkeyword", "--timeout", "soon", "prefix", "true", "abc"}, exitUsage, "invalid value \"soon\" for flag -timeout"},
+		{[]string{"genkeyword", "--wordlist", filepath.Join(dir, "missing"), "words", "true", "abc"}, exitUsage, "invalid value"},
+		{[]string{"genkeyword", "words-any", "true", "abc"}, exitUsage, "<case sensitive> must be false in the words-any mode"},
+
+		{[]string{"decrypt-nacl"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"decrypt-nacl", "AAA"}, exitUsage, "invalid message \"AAA\""},
+		{[]string{"decrypt-nacl", "AAAA"}, exitError, "PRIVATE_KEY or PRIVATE_KEY_FILE not found"},
+		{[]string{"encrypt-nacl", key}, exitUsage, "expected 2 arguments, got 1"},
+		{[]string{"encrypt-nacl", "AAA", "hello"}, exitUsage, "invalid public key \"AAA\""},
+		{[]string{"encrypt-nacl", "AAAA", "hello"}, exitError, "invalid public key size: 3"},
+		{[]string{"encrypt-nacl-auth", key}, exitUsage, "expected 2 arguments, got 1"},
+		{[]string{"encrypt-nacl-auth", key, "hello"}, exitError, "PRIVATE_KEY or PRIVATE_KEY_FILE not found"},
+		{[]string{"decrypt-nacl-auth", key}, exitUsage, "expected 2 arguments, got 1"},
+		{[]string{"decrypt-nacl-auth", key, "AAA"}, exitUsage, "invalid message \"AAA\""},
+
+		{[]string{"humanize-key"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"humanize-key", "AAA"}, exitUsage, "invalid key \"AAA\""},
+		{[]string{"humanize-key", "--interactive", key}, exitUsage, "flag provided but not defined: -interactive"},
+		{[]string{"humanize-key", "--wordlist", filepath.Join(dir, "missing"), key}, exitUsage, "invalid value"},
+		{[]string{"dehumanize-key"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"dehumanize-key", "notaword"}, exitError, "notaword"},
+		{[]string{"dehumanize-key", "--size", "-1", "the"}, exitUsage, "invalid --size -1"},
+		{[]string{"genkey-seed", "extra"}, exitUsage, "expected 0 arguments, got 1"},
+		{[]string{"restore-key"}, exitUsage, "expected 1 argument, got 0"},
+		{[]string{"split-key", "3"}, exitUsage, "expected 2 arguments, got 1"},
+		{[]string{"split-key", "three", "2"}, exitUsage, "invalid <shares> \"three\""},
+		{[]string{"split-key", "3", "two"}, exitUsage, "invalid <threshold> \"two\""},
+		{[]string{"split-key", "3", "2"}, exitError, "PRIVATE_KEY or PRIVATE_KEY_FILE not found"},
+		{[]string{"combine-key"}, exitUsage, "expected at least 1 argument, got 0"},
+		{[]string{"combine-key", "AAAA"}, exitError, "share 1: "},
+	}
+	tested := map[string]bool{}
+	for _, test := range tests {
+		code, stdout, stderr := runCommand(test.args...)
+		if code != test.code || !strings.Contains(stderr, test.message) {
+			t.Error(test.args, "exited with", code, "and printed", stderr, "expected", test.code, "and", test.message)
+		}
+		if code != exitOK && stdout != "" {
+			t.Error(test.args, "failed but printed to stdout:", stdout)
+		}
+		if code == exitUsage && len(test.args) > 0 && commands[test.args[0]].Run != nil && !strings.Contains(stderr, "Usage: "+programName+" "+test.args[0]) {
+			t.Error(test.args, "did not print its usage:", stderr)
+		}
+		if len(test.args) > 0 {
+			tested[test.args[0]] = true
+		}
+	}
+	for name := range commands {
+		if !tested[name] {
+			t.Error("the arguments of", name, "are not tested")
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	code, stdout, _ := runCommand("help")
+	if code != exitOK {
+		t.Fatal("help exited with", code)
+	}
+	var names []string
+	for _, line := range strings.Split(stdout, "\n") {
+		name, _, _ := strings.Cut(line, " ")
+		if _, ok := commands[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) != len(commands) || !sort.StringsAreSorted(names) {
+		t.Fatal("expected every command sorted by name, got", names)
+	}
+
+	for name, cmd := range commands {
+		for _, args := range [][]string{{"help", name}, {name, "--help"}, {name, "-h"}} {
+			if name == "help" && args[0] == name {
+				continue
+			}
+			code, stdout, stderr := runCommand(args...)
+			if code != exitOK || stderr != "" || !strings.HasPrefix(stdout, "Usage: "+programName+" "+cmd.usage(name)+"\n") {
+				t.Error(args, "exited with", code, "and printed", stdout, stderr)
+			}
+			for _, flagName := range cmd.Flags {
+				if !strings.Contains(stdout, "-"+flagName) {
+					t.Error(args, "does not describe", flagName)
+				}
+			}
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	unsetEnv(t, "PRIVATE_KEY_FILE")
+	code, stdout, _ := runCommand("genkey")
+	lines := strings.Split(stdout, "\n")
+	if code != exitOK || len(lines) < 5 {
+		t.Fatal("genkey exited with", code, "and printed", stdout)
+	}
+	publicKey, privateKey := lines[1], lines[4]
+
+	code, stdout, _ = runCommand("encrypt-nacl", publicKey, "hello")
+	lines = strings.Split(stdout, "\n")
+	if code != exitOK || len(lines) < 2 {
+		t.Fatal("encrypt-nacl exited with", code, "and printed", stdout)
+	}
+	t.Setenv("PRIVATE_KEY", privateKey)
+	if code, stdout, _ := runCommand("decrypt-nacl", lines[1]); code != exitOK || stdout != "hello\n" {
+		t.Fatal("decrypt-nacl exited with", code, "and printed", stdout)
+	}
+
+	dir := t.TempDir()
+	inFilePath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(inFilePath, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "notes.enc")
+	if code, stdout, stderr := runCommand("encrypt-file", "--metadata", "-o", encrypted, publicKey, inFilePath); code != exitOK || stdout != "File encrypted and saved to "+encrypted+"\n" {
+		t.Fatal("encrypt-file exited with", code, "and printed", stdout, stderr)
+	}
+	if code, _, stderr := runCommand("encrypt-file", "-o", encrypted, publicKey, inFilePath); code != exitError || stderr != "error: "+encrypted+" already exists, use --force to replace it\n" {
+		t.Fatal("encrypt-file exited with", code, "and printed", stderr)
+	}
+	decrypted := filepath.Join(dir, "decrypted.txt")
+	if code, stdout, stderr := runCommand("decrypt-file", "-o", decrypted, encrypted); code != exitOK || stdout != "File decrypted and saved to "+decrypted+"\n" {
+		t.Fatal("decrypt-file exited with", code, "and printed", stdout, stderr)
+	}
+	if data, err := os.ReadFile(decrypted); err != nil || string(data) != "hello" {
+		t.Fatal("expected hello, got", string(data), err)
+	}
+
+	// Key IDs are only written with --key-ids, and name the recipients when the private key is wrong.
+	otherPublicKey, _, err := encryption.GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := base64.StdEncoding.EncodeToString(otherPublicKey)
+	for _, keyIds := range []bool{false, true} {
+		withKeyIds := filepath.Join(dir, "other.enc")
+		if code, _, stderr := runCommand("encrypt-file", "--force", "--key-ids="+strconv.FormatBool(keyIds), "-o", withKeyIds, otherKey, inFilePath); code != exitOK {
+			t.Fatal("encrypt-file exited with", code, "and printed", stderr)
+		}
+		expected := "error: private key does not match any of the 1 recipients of the encrypted stream\n"
+		if keyIds {
+			expected = "error: wrong private key, this file is for " + encryption.Fingerprint(otherPublicKey) + "\n"
+		}
+		if code, _, stderr := runCommand("decrypt-file", "-o", filepath.Join(dir, "other.txt"), withKeyIds); code != exitError || stderr != expected {
+			t.Fatal("decrypt-file exited with", code, "and printed", stderr, "expected", expected)
+		}
+	}
+
+	// The name in the metadata is only used with --original-name, and never replaces a file.
+	if code, stdout, stderr := runCommand("decrypt-file", encrypted); code != exitOK || stdout != "File decrypted and saved to "+encrypted+".dec\n" {
+		t.Fatal("decrypt-file exited with", code, "and printed", stdout, stderr)
+	}
+	if code, _, stderr := runCommand("decrypt-file", "--original-name", "--force", encrypted); code != exitError || stderr != "error: "+inFilePath+" already exists\n" {
+		t.Fatal("decrypt-file exited with", code, "and printed", stderr)
+	}
+	if err := os.Remove(inFilePath); err != nil {
+		t.Fatal(err)
+	}
+	if code, stdout, stderr := runCommand("decrypt-file", "--original-name", encrypted); code != exitOK || stdout != "File decrypted and saved to "+inFilePath+"\n" {
+		t.Fatal("decrypt-file exited with", code, "and printed", stdout, stderr)
+	}
+	// A file whose original name is its own name can't replace itself.
+	if err := os.Rename(encrypted, inFilePath); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := runCommand("decrypt-file", "--original-name", "--force", inFilePath); code != exitError || stderr != "error: "+inFilePath+" already exists\n" {
+		t.Fatal("decrypt-file exited with", code, "and printed", stderr)
+	}
+}
+
+// runJSON runs args with --json added after the command, and returns the exit code and the decoded output.
+func runJSON(t *testing.T, args ...string) (int, map[string]interface{}) {
+	t.Helper()
+	args = append([]string{args[0], "--json"}, args[1:]...)
+	code, stdout, _ := runCommand(args...)
+	var output map[string]interface{}
+	if err := json.Unmarshal([]byte(stdout), &output); err != nil || strings.Count(stdout, "\n") != 1 {
+		t.Fatal(args, "did not print one JSON document:", stdout, err)
+	}
+	return code, output
+}
+
+// checkFields fails unless object has exactly the fields in names.
+func checkFields(t *testing.T, name string, object interface{}, names ...string) {
+	t.Helper()
+	m, ok := object.(map[string]interface{})
+	if !ok {
+		t.Fatal(name, "is not an object:", object)
+	}
+	var fields []string
+	for field := range m {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	sort.Strings(names)
+	if strings.Join(fields, ",") != strings.Join(names, ",") {
+		t.Fatal(name, "has the fields", fields, "expected", names)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	unsetEnv(t, "PRIVATE_KEY_FILE")
+	unsetEnv(t, "PRIVATE_KEY")
+	dir := t.TempDir()
+	keyFields := []string{"publicKey", "fingerprint", "humanized", "privateKey"}
+	fileFields := []string{"input", "output", "inputBytes", "outputBytes", "elapsedSeconds"}
+	tested := map[string]bool{}
+
+	// check runs args with --json and checks the exit code, the envelope and the fields of the result, or the code of
+	// the error. It returns the result.
+	check := func(args []string, code int, errorCode string, fields ...string) map[string]interface{} {
+		t.Helper()
+		tested[args[0]] = true
+		exitCode, output := runJSON(t, args...)
+		if exitCode != code || output["version"] != float64(jsonVersion) || output["command"] != args[0] || output["ok"] != (code == exitOK) {
+			t.Fatal(args, "exited with", exitCode, "and printed", output)
+		}
+		if errorCode != "" {
+			checkFields(t, "error", output["error"], "code", "message")
+			if code := output["error"].(map[string]interface{})["code"]; code != errorCode {
+				t.Fatal(args, "failed with", code, "expected", errorCode, output)
+			}
+		}
+		if fields == nil {
+			if _, ok := output["result"]; ok {
+				t.Fatal(args, "has a result", output)
+			}
+			return nil
+		}
+		checkFields(t, "result of "+args[0], output["result"], fields...)
+		return output["result"].(map[string]interface{})
+	}
+
+	check([]string{"help"}, exitOK, "", "commands")
+	help := check([]string{"help", "encrypt-file"}, exitOK, "", "commands")
+	commandsOutput := help["commands"].([]interface{})
+	checkFields(t, "command", commandsOutput[0], "name", "usage", "description", "flags")
+	checkFields(t, "flag", commandsOutput[0].(map[string]interface{})["flags"].([]interface{})[0], "name", "syntax", "usage")
+	check([]string{"nope"}, exitUsage, "usage")
+
+	keys := check([]string{"genkey"}, exitOK, "", keyFields...)
+	publicKey, privateKey := keys["publicKey"].(string), keys["privateKey"].(string)
+	publicKeyBytes, _ := base64.StdEncoding.DecodeString(publicKey)
+	if keys["fingerprint"] != encryption.Fingerprint(publicKeyBytes) {
+		t.Fatal("wrong fingerprint", keys)
+	}
+	otherKeys := check([]string{"genkey"}, exitOK, "", keyFields...)
+	seed := check([]string{"genkey-seed"}, exitOK, "", append(keyFields, "seedPhrase")...)
+	restored := check([]string{"restore-key", seed["seedPhrase"].(string)}, exitOK, "", keyFields...)
+	if restored["privateKey"] != seed["privateKey"] {
+		t.Fatal("restore-key restored", restored, "expected", seed)
+	}
+	check([]string{"restore-key", "notaword"}, exitError, "invalid_words")
+	humanizedKey := check([]string{"humanize-key", publicKey}, exitOK, "", "key", "humanized", "fingerprint", "checked")
+	if humanizedKey["key"] != publicKey || strings.HasSuffix(humanizedKey["humanized"].(string), " ") {
+		t.Fatal("wrong humanized key", humanizedKey)
+	}
+	dehumanized := check([]string{"dehumanize-key", humanizedKey["humanized"].(string)}, exitOK, "", "key", "humanized", "fingerprint", "checked")
+	if dehumanized["key"] != publicKey || dehumanized["checked"] != true {
+		t.Fatal("wrong dehumanized key", dehumanized)
+	}
+	// Data that is not a key round-trips too.
+	data := base64.StdEncoding.EncodeToString([]byte("not a key"))
+	humanizedData := check([]string{"humanize-key", data}, exitOK, "", "key", "humanized", "fingerprint", "checked")
+	check([]string{"dehumanize-key", humanizedData["humanized"].(string)}, exitError, "error")
+	for _, size := range []string{"9", "0"} {
+		dehumanized = check([]string{"dehumanize-key", "--size", size, humanizedData["humanized"].(string)}, exitOK, "", "key", "humanized", "fingerprint", "checked")
+		if dehumanized["key"] != data || dehumanized["checked"] != true {
+			t.Fatal("wrong dehumanized data for --size", size, dehumanized)
+		}
+	}
+	// Without checksum words, the size must be given.
+	unchecked := strings.Join(strings.Fields(humanizedData["humanized"].(string))[:9], " ")
+	dehumanized = check([]string{"dehumanize-key", "--size", "9", unchecked}, exitOK, "", "key", "humanized", "fingerprint", "checked")
+	if dehumanized["key"] != data || dehumanized["checked"] != false {
+		t.Fatal("wrong dehumanized data", dehumanized)
+	}
+	check([]string{"dehumanize-key", "--size", "0", unchecked}, exitError, "invalid_words")
+	check([]string{"genkey-file", filepath.Join(dir)}, exitError, "exists")
+	check([]string{"lock-key", filepath.Join(dir, "key")}, exitError, "missing_key")
+	check([]string{"unlock-key", filepath.Join(dir, "missing")}, exitError, "not_found")
+	check([]string{"change-passphrase", filepath.Join(dir, "missing")}, exitError, "not_found")
+	check([]string{"decrypt-nacl", "AAAA"}, exitError, "missing_key")
+	check([]string{"genkeyword", "--timeout", "1ms", "prefix", "true", "AAAAAAAAAA"}, exitError, "no_match", "expectedAttempts", "attempts", "elapsedSeconds", "keys")
+	// Words are a single sequence, so four words take 256^4 attempts.
+	fourWords := strings.Fields(humanize.Default.GetString([]byte{1, 2, 3, 4}))
+	vanityWords := check(append([]string{"genkeyword", "--timeout", "1ms", "words", "false"}, fourWords...), exitError, "no_match", "expectedAttempts", "attempts", "elapsedSeconds", "keys")
+	if vanityWords["expectedAttempts"] != float64(256*256*256*256) {
+		t.Fatal("expected 4294967296 attempts for", fourWords, "got", vanityWords)
+	}
+	vanityKeys := check([]string{"genkeyword", "prefix", "false", "a"}, exitOK, "", "expectedAttempts", "attempts", "elapsedSeconds", "keys")["keys"].([]interface{})
+	if len(vanityKeys) != 1 {
+		t.Fatal("expected one key, got", vanityKeys)
+	}
+	checkFields(t, "key of genkeyword", vanityKeys[0], append(keyFields, "pattern", "matchStart", "matchEnd", "elapsedSeconds")...)
+
+	t.Setenv("PRIVATE_KEY", privateKey)
+	encrypted := check([]string{"encrypt-nacl", publicKey, "hello"}, exitOK, "", "message")
+	message := check([]string{"decrypt-nacl", encrypted["message"].(string)}, exitOK, "", "message", "text")
+	if message["text"] != "hello" || message["message"] != base64.StdEncoding.EncodeToString([]byte("hello")) {
+		t.Fatal("wrong message", message)
+	}
+	encrypted = check([]string{"encrypt-nacl-auth", publicKey, "hello"}, exitOK, "", "message")
+	check([]string{"decrypt-nacl-auth", publicKey, encrypted["message"].(string)}, exitOK, "", "senderPublicKey", "message", "text")
+	check([]string{"decrypt-nacl-auth", otherKeys["publicKey"].(string), encrypted["message"].(string)}, exitError, "wrong_sender")
+
+	split := check([]string{"split-key", "3", "2"}, exitOK, "", "fingerprint", "threshold", "shares")
+	shares := split["shares"].([]interface{})
+	checkFields(t, "share", shares[0], "index", "share", "words")
+	combined := check([]string{"combine-key", shares[0].(map[string]interface{})["share"].(string), shares[2].(map[string]interface{})["words"].(string)}, exitOK, "", keyFields...)
+	if combined["privateKey"] != privateKey {
+		t.Fatal("combine-key restored", combined)
+	}
+	check([]string{"combine-key", "AAAA"}, exitError, "invalid_shares")
+
+	inFilePath := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(inFilePath, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	encryptedFile := check([]string{"encrypt-file", "--metadata", publicKey, inFilePath}, exitOK, "", append(fileFields, "recipients")...)
+	if encryptedFile["inputBytes"] != float64(5) || encryptedFile["output"] != inFilePath+".enc" || encryptedFile["recipients"].([]interface{})[0] != keys["fingerprint"] {
+		t.Fatal("wrong output of encrypt-file", encryptedFile)
+	}
+	check([]string{"encrypt-file", publicKey, inFilePath}, exitError, "exists")
+	check([]string{"encrypt-file", publicKey, filepath.Join(dir, "missing")}, exitError, "not_found")
+	inspected := check([]string{"inspect-file", inFilePath + ".enc"}, exitOK, "", "file", "metadata")
+	checkFields(t, "metadata", inspected["metadata"], "name", "size", "mode", "modTime", "contentType")
+	decrypted := filepath.Join(dir, "decrypted.txt")
+	check([]string{"decrypt-file", "-o", decrypted, inFilePath + ".enc"}, exitOK, "", fileFields...)
+	encryptedData, err := os.ReadFile(inFilePath + ".enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, encryptedData...)
+	tampered[len(tampered)-1] ^= 1
+	for name, data := range map[string][]byte{"tampered.enc": tampered, "truncated.enc": encryptedData[:len(encryptedData)-5]} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		check([]string{"decrypt-file", "-o", filepath.Join(dir, name+".txt"), filepath.Join(dir, name)}, exitError, "corrupt")
+	}
+	check([]string{"encrypt-file-auth", "-o", filepath.Join(dir, "auth.enc"), publicKey, inFilePath}, exitOK, "", append(fileFields, "recipients", "senderPublicKey")...)
+	check([]string{"decrypt-file-auth", "-o", filepath.Join(dir, "auth.txt"), publicKey, filepath.Join(dir, "auth.enc")}, exitOK, "", append(fileFields, "senderPublicKey")...)
+	check([]string{"decrypt-file-auth", "-o", filepath.Join(dir, "wrong.txt"), otherKeys["publicKey"].(string), filepath.Join(dir, "auth.enc")}, exitError, "wrong_sender")
+	check([]string{"encrypt-dir", "-o", filepath.Join(dir, "dir.enc"), publicKey, filepath.Join(dir)}, exitOK, "", "input", "output", "outputBytes", "elapsedSeconds", "recipients")
+	check([]string{"decrypt-dir", "-o", filepath.Join(dir, "dir"), filepath.Join(dir, "dir.enc")}, exitOK, "", "input", "output", "inputBytes", "elapsedSeconds")
+	check([]string{"decrypt-dir", "-o", filepath.Join(dir, "dir"), filepath.Join(dir, "dir.enc")}, exitError, "exists")
+	t.Setenv("PRIVATE_KEY", otherKeys["privateKey"].(string))
+	check([]string{"decrypt-file", "-o", filepath.Join(dir, "wrong.txt"), inFilePath + ".enc"}, exitError, "wrong_key")
+
+	signingKeys := check([]string{"genkey-sign"}, exitOK, "", "signingPublicKey", "signingPrivateKey")
+	t.Setenv("SIGNING_KEY", signingKeys["signingPrivateKey"].(string))
+	signed := check([]string{"sign-file", inFilePath}, exitOK, "", "file", "signatureFile", "verified")
+	if signed["signatureFile"] != inFilePath+".sig" || signed["verified"] != false {
+		t.Fatal("wrong output of sign-file", signed)
+	}
+	signingPublicKey := signingKeys["signingPublicKey"].(string)
+	check([]string{"verify-file", signingPublicKey, inFilePath}, exitOK, "", "file", "signatureFile", "verified")
+	check([]string{"verify-file", signingPublicKey, decrypted, inFilePath + ".sig"}, exitOK, "", "file", "signatureFile", "verified")
+	if err := os.WriteFile(decrypted, []byte("changed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	check([]string{"verify-file", signingPublicKey, decrypted, inFilePath + ".sig"}, exitError, "invalid_signature")
+
+	for name := range commands {
+		if !tested[name] {
+			t.Error("the JSON output of", name, "is not tested")
+		}
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := w.WriteString("first\nsecond\n"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	stdin, path := os.Stdin, ttyPath
+	defer func() { os.Stdin, ttyPath, lineReader = stdin, path, nil }()
+	os.Stdin, ttyPath, lineReader = r, filepath.Join(t.TempDir(), "tty"), nil
+
+	// Both lines are read from stdin, even though the first read gets both of them.
+	for _, expected := range []string{"first", "second"} {
+		if line, err := readLine(""); err != nil || line != expected {
+			t.Fatal("expected", expected, "got", line, err)
+		}
+	}
+}
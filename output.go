@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"github.com/masquernya/go-encryption-program/ferret"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"github.com/masquernya/go-encryption-program/shamir"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// jsonVersion is the version of the --json output. It only changes when a field is removed or changes meaning, adding
+// fields keeps the version.
+const jsonVersion = 1
+
+// result is the output of a command. It is printed as text, or as the result of the --json output.
+type result interface {
+	// printText prints the result for people to read.
+	printText(c *cli)
+}
+
+// jsonOutput is the document printed by a command with --json.
+type jsonOutput struct {
+	Version int    `json:"version"`
+	Command string `json:"command"`
+	OK      bool   `json:"ok"`
+	// The output of the command. Failed commands may still have one, such as the attempts of genkeyword.
+	Result result     `json:"result,omitempty"`
+	Error  *jsonError `json:"error,omitempty"`
+}
+
+// jsonError describes why a command failed.
+type jsonError struct {
+	// One of the error codes returned by errorCode.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// print prints r as text, or saves it to be printed as JSON once the command is done.
+func (c *cli) print(r result) {
+	if c.json {
+		c.result = r
+		return
+	}
+	r.printText(c)
+}
+
+// printJSON prints the --json output of the command called name, which failed if err is not nil. The output goes to
+// stdout, unless the data of the command is written there.
+func (c *cli) printJSON(name string, err error) {
+	output := jsonOutput{Version: jsonVersion, Command: name, OK: err == nil, Result: c.result}
+	if err != nil {
+		output.Error = &jsonError{Code: errorCode(err), Message: err.Error()}
+	}
+	w := c.stdout
+	if c.dataOnStdout {
+		w = c.stderr
+	}
+	data, _ := json.Marshal(output)
+	fmt.Fprintln(w, string(data))
+}
+
+// existsError is returned when the output of a command already exists.
+type existsError struct {
+	Path string
+	// Whether --force replaces it.
+	Force bool
+}
+
+func (e *existsError) Error() string {
+	if e.Force {
+		return e.Path + " already exists, use --force to replace it"
+	}
+	return e.Path + " already exists"
+}
+
+// errMissingChecksum is returned by restore-key for a seed phrase without checksum words.
+var errMissingChecksum = errors.New("seed phrase is missing its checksum words")
+
+// missingKeyError is returned when a key is not in the environment.
+type missingKeyError struct {
+	// Names of the environmental variables the key can be in, such as "PRIVATE_KEY or PRIVATE_KEY_FILE".
+	Names string
+}
+
+func (e *missingKeyError) Error() string {
+	return "Environment variable " + e.Names + " not found"
+}
+
+// noMatchError is returned when genkeyword stops without finding a key.
+type noMatchError struct {
+	Attempts uint64
+	Elapsed  time.Duration
+}
+
+func (e *noMatchError) Error() string {
+	return "No key found after " + formatCount(float64(e.Attempts)) + " attempts in " + formatSeconds(e.Elapsed.Seconds())
+}
+
+// wrongSenderError is returned when a message was not sent by the expected sender.
+type wrongSenderError struct {
+	Sender []byte
+}
+
+func (e *wrongSenderError) Error() string {
+	return "message was sent by " + base64.StdEncoding.EncodeToString(e.Sender) + ", not the expected sender"
+}
+
+// errorCode returns the code of err in the --json output. The codes are:
+//
+//   - usage: the command line is invalid, such as an unknown flag, a missing argument or invalid Base64
+//   - missing_key: the key is not in the environment
+//   - exists: the output already exists
+//   - not_found: a file does not exist
+//   - permission: a file can't be read or written
+//   - wrong_key: the private key is not a recipient of the file
+//   - wrong_sender: the message or file was not sent by the expected sender
+//   - wrong_passphrase: the passphrase of a private key file is wrong
+//   - corrupt: the encrypted data is truncated or was tampered with
+//   - invalid_signature: the signature does not match the file or key
+//   - invalid_words: a humanized key or seed phrase has an unknown word or a wrong checksum
+//   - invalid_shares: key shares are corrupt or don't belong together
+//   - unsafe_path: an encrypted directory has a file outside of it
+//   - no_match: genkeyword stopped without finding a key
+//   - error: any other error
+func errorCode(err error) string {
+	switch e := err.(type) {
+	case *usageError:
+		return "usage"
+	case *missingKeyError:
+		return "missing_key"
+	case *existsError:
+		return "exists"
+	case *encryption.RecipientError:
+		return "wrong_key"
+	case *wrongSenderError:
+		return "wrong_sender"
+	case *humanize.WordError, *humanize.ChecksumError:
+		return "invalid_words"
+	case *ferret.UnsafePathError:
+		return "unsafe_path"
+	case *noMatchError:
+		return "no_match"
+	case *shareError:
+		if code := errorCode(e.Err); code != "error" {
+			return code
+		}
+		return "invalid_shares"
+	}
+	switch {
+	case os.IsExist(err):
+		return "exists"
+	case os.IsNotExist(err):
+		return "not_found"
+	case os.IsPermission(err):
+		return "permission"
+	}
+	switch err {
+	case encryption.ErrWrongSender, encryption.ErrNotAuthenticated:
+		return "wrong_sender"
+	case errMissingChecksum:
+		return "invalid_words"
+	case encryption.ErrWrongPassphrase:
+		return "wrong_passphrase"
+	case encryption.ErrTruncated, encryption.ErrChunkOrder, encryption.ErrCorrupt:
+		return "corrupt"
+	case encryption.ErrInvalidSignature, encryption.ErrWrongSigner:
+		return "invalid_signature"
+	case shamir.ErrCorruptShare, shamir.ErrMixedShares, shamir.ErrInconsistentShares:
+		return "invalid_shares"
+	}
+	return "error"
+}
+
+// shareError is returned for a share of combine-key that can't be read.
+type shareError struct {
+	// Index of the share in the arguments, starting at 0.
+	Position int
+	Err      error
+}
+
+func (e *shareError) Error() string {
+	return "share " + strconv.Itoa(e.Position+1) + ": " + e.Err.Error()
+}
+
+// fileSize returns the size of the file at path, or nil for stdin and stdout, or if it can't be read.
+func fileSize(path string) *int64 {
+	if path == ferret.StdioPath {
+		return nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil || !stat.Mode().IsRegular() {
+		return nil
+	}
+	size := stat.Size()
+	return &size
+}
+
+// humanized returns data as words from wordlist followed by checksum words, without the space GetStringChecked ends
+// with.
+func humanized(wordlist *humanize.Wordlist, data []byte) string {
+	return strings.TrimSpace(wordlist.GetStringChecked(data))
+}
+
+// fingerprints returns the fingerprint of every public key.
+func fingerprints(publicKeys [][]byte) []string {
+	var result []string
+	for _, publicKey := range publicKeys {
+		result = append(result, encryption.Fingerprint(publicKey))
+	}
+	return result
+}
+
+// keyOutput is a public key, and its private key if it is known.
+type keyOutput struct {
+	PublicKey   string `json:"publicKey"`
+	Fingerprint string `json:"fingerprint"`
+	// The public key as words, from the --wordlist of the command or the default word list.
+	Humanized  string `json:"humanized"`
+	PrivateKey string `json:"privateKey,omitempty"`
+}
+
+// newKeyOutput returns the keyOutput of publicKey and privateKey, which may be nil.
+func newKeyOutput(publicKey []byte, privateKey []byte, wordlist *humanize.Wordlist) keyOutput {
+	output := keyOutput{
+		PublicKey:   base64.StdEncoding.EncodeToString(publicKey),
+		Fingerprint: encryption.Fingerprint(publicKey),
+		Humanized:   humanized(wordlist, publicKey),
+	}
+	if privateKey != nil {
+		output.PrivateKey = base64.StdEncoding.EncodeToString(privateKey)
+	}
+	return output
+}
+
+func (r keyOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "Public Key (Base64):")
+	fmt.Fprintln(c.stdout, r.PublicKey)
+	fmt.Fprintln(c.stdout, "Fingerprint: "+r.Fingerprint)
+	if r.PrivateKey != "" {
+		fmt.Fprintln(c.stdout, "Private Key (Base64):")
+		fmt.Fprintln(c.stdout, r.PrivateKey)
+	}
+}
+
+// seedOutput is the result of genkey-seed.
+type seedOutput struct {
+	SeedPhrase string `json:"seedPhrase"`
+	keyOutput
+}
+
+func (r seedOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "Seed Phrase (write this down, it can restore the private key):")
+	fmt.Fprintln(c.stdout, r.SeedPhrase)
+	r.keyOutput.printText(c)
+}
+
+// keyFileOutput is the result of genkey-file and lock-key.
+type keyFileOutput struct {
+	KeyFile string `json:"keyFile"`
+	keyOutput
+}
+
+func (r keyFileOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "Private key encrypted and saved to "+r.KeyFile)
+	r.keyOutput.printText(c)
+}
+
+// passphraseOutput is the result of change-passphrase.
+type passphraseOutput struct {
+	KeyFile string `json:"keyFile"`
+}
+
+func (r passphraseOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "Passphrase changed for "+r.KeyFile)
+}
+
+// signingKeyOutput is the result of genkey-sign.
+type signingKeyOutput struct {
+	SigningPublicKey  string `json:"signingPublicKey"`
+	SigningPrivateKey string `json:"signingPrivateKey"`
+}
+
+func (r signingKeyOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "Signing Public Key (Base64):")
+	fmt.Fprintln(c.stdout, r.SigningPublicKey)
+	fmt.Fprintln(c.stdout, "Signing Private Key (Base64):")
+	fmt.Fprintln(c.stdout, r.SigningPrivateKey)
+}
+
+// signatureOutput is the result of sign-file and verify-file.
+type signatureOutput struct {
+	File          string `json:"file"`
+	SignatureFile string `json:"signatureFile"`
+	// True for verify-file, false for sign-file.
+	Verified bool `json:"verified"`
+}
+
+func (r signatureOutput) printText(c *cli) {
+	if r.Verified {
+		fmt.Fprintln(c.stdout, "Signature verified")
+		return
+	}
+	fmt.Fprintln(c.stdout, "Signature saved to "+r.SignatureFile)
+}
+
+// fileOutput is the result of the commands that encrypt and decrypt files and directories.
+type fileOutput struct {
+	// What was encrypted or decrypted: "File" or "Directory".
+	kind string
+	// True when encrypting.
+	encrypted bool
+	// Path of the input, or - for stdin.
+	Input string `json:"input"`
+	// Path of the output, or - for stdout.
+	Output string `json:"output"`
+	// Sizes in bytes. Not set for stdin, stdout and directories.
+	InputBytes     *int64  `json:"inputBytes,omitempty"`
+	OutputBytes    *int64  `json:"outputBytes,omitempty"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	// Fingerprints of the recipients, when encrypting.
+	Recipients []string `json:"recipients,omitempty"`
+	// The sender who authenticated the file, for encrypt-file-auth and decrypt-file-auth.
+	SenderPublicKey string `json:"senderPublicKey,omitempty"`
+}
+
+func (r fileOutput) printText(c *cli) {
+	status := c.statusOutput(r.Output)
+	if r.encrypted {
+		fmt.Fprintln(status, r.kind+" encrypted and "+savedTo(r.Output))
+	} else {
+		fmt.Fprintln(status, r.kind+" decrypted and "+savedTo(r.Output))
+	}
+	if r.SenderPublicKey == "" {
+		return
+	}
+	if r.encrypted {
+		fmt.Fprintln(status, "Sender Public Key (Base64):")
+	} else {
+		fmt.Fprintln(status, "Verified Sender Public Key (Base64):")
+	}
+	fmt.Fprintln(status, r.SenderPublicKey)
+}
+
+// metadataOutput is the encrypted metadata of a file.
+type metadataOutput struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// Permissions, such as "-rw-r--r--".
+	Mode string `json:"mode"`
+	// Modification time in RFC 3339 format.
+	ModTime     string `json:"modTime"`
+	ContentType string `json:"contentType"`
+}
+
+// inspectOutput is the result of inspect-file.
+type inspectOutput struct {
+	File string `json:"file"`
+	// Nil if the file has no metadata.
+	Metadata *metadataOutput `json:"metadata"`
+}
+
+// newInspectOutput returns the inspectOutput of the file at path with metadata, which may be nil.
+func newInspectOutput(path string, metadata *encryption.Metadata) inspectOutput {
+	output := inspectOutput{File: path}
+	if metadata != nil {
+		output.Metadata = &metadataOutput{
+			Name:        metadata.Name,
+			Size:        metadata.Size,
+			Mode:        metadata.Mode.String(),
+			ModTime:     metadata.ModTime.Format(time.RFC3339),
+			ContentType: metadata.ContentType,
+		}
+	}
+	return output
+}
+
+func (r inspectOutput) printText(c *cli) {
+	if r.Metadata == nil {
+		fmt.Fprintln(c.stdout, "File has no metadata")
+		return
+	}
+	fmt.Fprintln(c.stdout, "Name: "+r.Metadata.Name)
+	fmt.Fprintln(c.stdout, "Size: "+strconv.FormatInt(r.Metadata.Size, 10)+" bytes")
+	fmt.Fprintln(c.stdout, "Mode: "+r.Metadata.Mode)
+	fmt.Fprintln(c.stdout, "Modified: "+r.Metadata.ModTime)
+	fmt.Fprintln(c.stdout, "Content Type: "+r.Metadata.ContentType)
+}
+
+// encryptedMessageOutput is the result of encrypt-nacl and encrypt-nacl-auth.
+type encryptedMessageOutput struct {
+	// The encrypted message in Base64.
+	Message string `json:"message"`
+}
+
+func (r encryptedMessageOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "Encrypted message (Base64):")
+	fmt.Fprintln(c.stdout, r.Message)
+}
+
+// messageOutput is the result of decrypt-nacl and decrypt-nacl-auth.
+type messageOutput struct {
+	// The verified sender, for decrypt-nacl-auth.
+	SenderPublicKey string `json:"senderPublicKey,omitempty"`
+	// The decrypted message in Base64.
+	Message string `json:"message"`
+	// The decrypted message, if it is valid UTF-8.
+	Text *string `json:"text,omitempty"`
+}
+
+// newMessageOutput returns the messageOutput of a decrypted message, and sender if it is set.
+func newMessageOutput(message []byte, sender []byte) messageOutput {
+	output := messageOutput{Message: base64.StdEncoding.EncodeToString(message)}
+	if sender != nil {
+		output.SenderPublicKey = base64.StdEncoding.EncodeToString(sender)
+	}
+	if utf8.Valid(message) {
+		text := string(message)
+		output.Text = &text
+	}
+	return output
+}
+
+func (r messageOutput) printText(c *cli) {
+	if r.SenderPublicKey != "" {
+		fmt.Fprintln(c.stdout, "Verified Sender Public Key (Base64):")
+		fmt.Fprintln(c.stdout, r.SenderPublicKey)
+	}
+	if r.Text == nil {
+		fmt.Fprintln(c.stdout, "Message (Base64):")
+		fmt.Fprintln(c.stdout, r.Message)
+		return
+	}
+	fmt.Fprintln(c.stdout, *r.Text)
+}
+
+// humanizedOutput is the result of humanize-key and dehumanize-key.
+type humanizedOutput struct {
+	// True for dehumanize-key.
+	dehumanized bool
+	// The key in Base64.
+	Key         string `json:"key"`
+	Humanized   string `json:"humanized"`
+	Fingerprint string `json:"fingerprint"`
+	// False if the humanized key has no checksum words.
+	Checked bool `json:"checked"`
+}
+
+func (r humanizedOutput) printText(c *cli) {
+	if r.dehumanized {
+		fmt.Fprintln(c.stdout, "Dehumanized key (Base64):")
+		fmt.Fprintln(c.stdout, r.Key)
+		return
+	}
+	fmt.Fprintln(c.stdout, "Humanized key:")
+	fmt.Fprintln(c.stdout, r.Humanized)
+	fmt.Fprintln(c.stdout, "Fingerprint: "+r.Fingerprint)
+}
+
+// shareOutput is a share of split-key.
+type shareOutput struct {
+	Index int `json:"index"`
+	// The share in Base64.
+	Share string `json:"share"`
+	// The share as words.
+	Words string `json:"words"`
+}
+
+// splitOutput is the result of split-key.
+type splitOutput struct {
+	// Whether --words was given, to print the words of every share.
+	words       bool
+	Fingerprint string        `json:"fingerprint"`
+	Threshold   int           `json:"threshold"`
+	Shares      []shareOutput `json:"shares"`
+}
+
+func (r splitOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "Split private key for "+r.Fingerprint+" into "+strconv.Itoa(len(r.Shares))+" shares, any "+strconv.Itoa(r.Threshold)+" of which can restore it.")
+	for _, share := range r.Shares {
+		fmt.Fprintln(c.stdout, "Share "+strconv.Itoa(share.Index)+" (Base64):")
+		fmt.Fprintln(c.stdout, share.Share)
+		if r.words {
+			fmt.Fprintln(c.stdout, "Share "+strconv.Itoa(share.Index)+" (Words):")
+			fmt.Fprintln(c.stdout, share.Words)
+		}
+	}
+}
+
+// vanityKeyOutput is a key found by genkeyword.
+type vanityKeyOutput struct {
+	elapsed time.Duration
+	// The <word> that matched.
+	Pattern string `json:"pattern"`
+	// Where the pattern matched in the Base64 public key, or -1 if it is not known.
+	MatchStart     int     `json:"matchStart"`
+	MatchEnd       int     `json:"matchEnd"`
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+	keyOutput
+}
+
+func (r vanityKeyOutput) printText(c *cli) {
+	fmt.Fprintln(c.stdout, "took", r.elapsed)
+	fmt.Fprintln(c.stdout, "Matched: "+r.Pattern)
+	fmt.Fprintln(c.stdout, "Public Key (Base64):")
+	fmt.Fprintln(c.stdout, r.PublicKey)
+	if r.MatchStart != -1 {
+		fmt.Fprintln(c.stdout, strings.Repeat(" ", r.MatchStart)+strings.Repeat("^", r.MatchEnd-r.MatchStart))
+	}
+	fmt.Fprintln(c.stdout, "Humanized key:")
+	fmt.Fprintln(c.stdout, r.Humanized)
+	fmt.Fprintln(c.stdout, "Fingerprint: "+r.Fingerprint)
+	fmt.Fprintln(c.stdout, "Private Key (Base64):")
+	fmt.Fprintln(c.stdout, r.PrivateKey)
+}
+
+// vanityOutput is the result of genkeyword.
+type vanityOutput struct {
+	// Expected number of attempts, or 0 if it is not known.
+	ExpectedAttempts float64 `json:"expectedAttempts"`
+	Attempts         uint64  `json:"attempts"`
+	ElapsedSeconds   float64 `json:"elapsedSeconds"`
+	// The file from --matches, if given.
+	MatchesFile string            `json:"matchesFile,omitempty"`
+	Keys        []vanityKeyOutput `json:"keys"`
+}
+
+func (r vanityOutput) printText(c *cli) {
+	if r.MatchesFile != "" {
+		fmt.Fprintln(c.stdout, "Found "+strconv.Itoa(len(r.Keys))+" keys in "+formatCount(float64(r.Attempts))+" attempts, saved to "+r.MatchesFile)
+		return
+	}
+	for _, key := range r.Keys {
+		key.printText(c)
+	}
+}
+
+// flagOutput is a flag in the output of help.
+type flagOutput struct {
+	Name string `json:"name"`
+	// How the flag is written, such as "-o <outpath>".
+	Syntax string `json:"syntax"`
+	Usage  string `json:"usage"`
+}
+
+// commandOutput is a command in the output of help.
+type commandOutput struct {
+	Name        string       `json:"name"`
+	Usage       string       `json:"usage"`
+	Description string       `json:"description"`
+	Flags       []flagOutput `json:"flags"`
+}
+
+// helpOutput is the result of help.
+type helpOutput struct {
+	Commands []commandOutput `json:"commands"`
+}
+
+// newHelpOutput returns the helpOutput of the commands in names, or of every command sorted by name if names is empty.
+func newHelpOutput(names []string) helpOutput {
+	if len(names) == 0 {
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var output helpOutput
+	for _, name := range names {
+		cmd := commands[name]
+		commandOutput := commandOutput{Name: name, Usage: cmd.usage(name), Description: cmd.Description}
+		fs := cmd.flagSet(name, &options{})
+		for _, flagName := range cmd.allFlags() {
+			f := fs.Lookup(flagName)
+			_, usage := flag.UnquoteUsage(f)
+			commandOutput.Flags = append(commandOutput.Flags, flagOutput{Name: f.Name, Syntax: flagSyntax(f), Usage: usage})
+		}
+		output.Commands = append(output.Commands, commandOutput)
+	}
+	return output
+}
+
+func (r helpOutput) printText(c *cli) {
+	if len(r.Commands) == 1 {
+		printCommandHelp(c.stdout, r.Commands[0].Name)
+		return
+	}
+	printHelp(c.stdout)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+// readPassphrase prints prompt and reads a passphrase from the terminal without echoing it. The terminal is opened
+// directly, so it works even when stdin is redirected.
+func readPassphrase(prompt string) ([]byte, error) {
+	tty, err := os.Open(ttyPath)
+	if err != nil {
+		// No controlling terminal (such as on Windows), fall back to stdin.
+		tty = os.Stdin
+	} else {
+		defer tty.Close()
+	}
+	if !term.IsTerminal(int(tty.Fd())) {
+		return nil, errors.New("cannot read passphrase: not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return passphrase, nil
+}
+
+// ttyPath is the terminal prompts read from.
+var ttyPath = "/dev/tty"
+
+// lineReader reads the answers to every prompt of readLine. It is kept for the whole program, since a new reader would
+// lose the lines the previous one buffered when stdin is a pipe.
+var lineReader *bufio.Reader
+
+// readLine prints prompt and reads a line from the terminal, or from stdin if there is no terminal.
+func readLine(prompt string) (string, error) {
+	if lineReader == nil {
+		// The terminal stays open for later prompts.
+		tty, err := os.Open(ttyPath)
+		if err != nil {
+			tty = os.Stdin
+		}
+		lineReader = bufio.NewReader(tty)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := lineReader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readNewPassphrase asks for a new passphrase twice, making sure both match.
+func readNewPassphrase() ([]byte, error) {
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+	confirm, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, confirm) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// unlockPrivateKey asks for the passphrase of the private key file at path and decrypts it.
+func unlockPrivateKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := readPassphrase("Passphrase for " + path + ": ")
+	if err != nil {
+		return nil, err
+	}
+	return encryption.DecryptPrivateKey(data, passphrase)
+}
+
+// readKeyEnv returns the Base64 key in the environmental variable called name.
+func readKeyEnv(name string) ([]byte, error) {
+	keyStr, keyExists := os.LookupEnv(name)
+	if !keyExists {
+		return nil, &missingKeyError{Names: name}
+	}
+	key, err := base64.StdEncoding.DecodeString(keyStr)
+	if err != nil {
+		return nil, errors.New("Environment variable " + name + " is not valid Base64: " + err.Error())
+	}
+	return key, nil
+}
+
+// readPrivateKey returns the private key from the file in the PRIVATE_KEY_FILE environmental variable, or from the
+// PRIVATE_KEY environmental variable if it is not set.
+func readPrivateKey() ([]byte, error) {
+	if path, ok := os.LookupEnv("PRIVATE_KEY_FILE"); ok {
+		return unlockPrivateKey(path)
+	}
+	if _, ok := os.LookupEnv("PRIVATE_KEY"); !ok {
+		return nil, &missingKeyError{Names: "PRIVATE_KEY or PRIVATE_KEY_FILE"}
+	}
+	return readKeyEnv("PRIVATE_KEY")
+}
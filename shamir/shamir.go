@@ -0,0 +1,179 @@
+// Package shamir splits secrets into shares with Shamir's secret sharing over GF(256), so any threshold of the shares
+// can recover the secret, but fewer shares reveal nothing about it.
+package shamir
+
+import (
+	"bytes"
+	crypto_ran "crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"github.com/masquernya/go-encryption-program/gf256"
+	"strconv"
+)
+
+// MagicBytesShare starts every encoded share.
+const MagicBytesShare string = "OwOP"
+
+const (
+	commitmentSize    = 8
+	commitmentKeySize = 16
+	checksumSize      = 4
+	// Magic bytes, threshold, index, commitment, share of the commitment key and checksum.
+	shareOverhead = 4 + 1 + 1 + commitmentSize + commitmentKeySize + checksumSize
+)
+
+// Prefix of the hash committing to the secret, so it can't be confused with other hashes of it.
+const commitmentPrefix = "OwO shamir commitment"
+
+var (
+	// ErrCorruptShare is returned when the checksum of an encoded share does not match.
+	ErrCorruptShare = errors.New("share is corrupt")
+	// ErrMixedShares is returned when shares are from different secrets, or were split with different thresholds.
+	ErrMixedShares = errors.New("shares are from different splits")
+	// ErrInconsistentShares is returned when shares combine to a secret that does not match their commitment, which
+	// means at least one of them was changed.
+	ErrInconsistentShares = errors.New("shares are inconsistent, at least one of them is wrong")
+)
+
+// Share is one share of a split secret.
+type Share struct {
+	// Number of shares needed to recover the secret.
+	Threshold byte
+	// X coordinate of the share, from 1 to 255.
+	Index byte
+	// Commitment to the secret, the same for every share of a split. Combine uses it to check the recovered secret.
+	Commitment []byte
+	// Y coordinates of the random key the commitment is made with, which is split like the secret. Without the key,
+	// the commitment can't be used to check a guess of the secret.
+	Key []byte
+	// Y coordinates of the share, one for each byte of the secret.
+	Value []byte
+}
+
+func commitment(key []byte, secret []byte) []byte {
+	h := sha256.Sum256(append(append([]byte(commitmentPrefix), key...), secret...))
+	return h[:commitmentSize]
+}
+
+// Split splits secret into n shares, any threshold of which can recover it.
+func Split(secret []byte, n int, threshold int) ([]Share, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret cannot be empty")
+	}
+	if n < 2 || n > 255 {
+		return nil, errors.New("invalid number of shares: " + strconv.Itoa(n))
+	}
+	if threshold < 2 || threshold > n {
+		return nil, errors.New("invalid threshold: " + strconv.Itoa(threshold))
+	}
+	key := make([]byte, commitmentKeySize)
+	if _, err := crypto_ran.Read(key); err != nil {
+		return nil, err
+	}
+	data := append(append([]byte{}, key...), secret...)
+	shares := make([]Share, n)
+	// Y coordinates of every share, the share of the key followed by that of the secret.
+	values := make([][]byte, n)
+	for i := range shares {
+		values[i] = make([]byte, len(data))
+		shares[i] = Share{
+			Threshold:  byte(threshold),
+			Index:      byte(i + 1),
+			Commitment: commitment(key, secret),
+			Key:        values[i][:commitmentKeySize],
+			Value:      values[i][commitmentKeySize:],
+		}
+	}
+	// Every byte of the key and the secret is the constant term of its own random polynomial of degree threshold-1.
+	coefficients := make([]byte, threshold)
+	for j, b := range data {
+		coefficients[0] = b
+		if _, err := crypto_ran.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			// Horner's method.
+			var y byte
+			for k := threshold - 1; k >= 0; k-- {
+				y = gf256.Add(gf256.Mul(y, shares[i].Index), coefficients[k])
+			}
+			values[i][j] = y
+		}
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from at least the threshold of its shares. It returns an error if the shares don't all
+// belong to the same split, or if they don't combine to the secret they were split from.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+	first := shares[0]
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if share.Threshold != first.Threshold || !bytes.Equal(share.Commitment, first.Commitment) || len(share.Key) != commitmentKeySize || len(share.Value) != len(first.Value) {
+			return nil, ErrMixedShares
+		}
+		if share.Index == 0 || seen[share.Index] {
+			return nil, errors.New("duplicate or invalid share index: " + strconv.Itoa(int(share.Index)))
+		}
+		seen[share.Index] = true
+	}
+	if len(shares) < int(first.Threshold) {
+		return nil, errors.New("need " + strconv.Itoa(int(first.Threshold)) + " shares, got " + strconv.Itoa(len(shares)))
+	}
+	// Lagrange interpolation at x=0 using every share, so extra shares are checked too.
+	data := make([]byte, commitmentKeySize+len(first.Value))
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gf256.Mul(basis, gf256.Div(other.Index, gf256.Add(other.Index, share.Index)))
+			}
+		}
+		for k, y := range append(append([]byte{}, share.Key...), share.Value...) {
+			data[k] = gf256.Add(data[k], gf256.Mul(y, basis))
+		}
+	}
+	key, secret := data[:commitmentKeySize], data[commitmentKeySize:]
+	if !bytes.Equal(commitment(key, secret), first.Commitment) {
+		return nil, ErrInconsistentShares
+	}
+	return secret, nil
+}
+
+// EncodedSize returns the size of the encoded shares of a secret of secretSize bytes.
+func EncodedSize(secretSize int) int {
+	return shareOverhead + secretSize
+}
+
+// Bytes encodes the share, with a checksum so corruption is detected by ParseShare.
+func (s Share) Bytes() []byte {
+	b := append([]byte(MagicBytesShare), s.Threshold, s.Index)
+	b = append(b, s.Commitment...)
+	b = append(b, s.Key...)
+	b = append(b, s.Value...)
+	h := sha256.Sum256(b)
+	return append(b, h[:checksumSize]...)
+}
+
+// ParseShare decodes a share encoded by Share.Bytes.
+func ParseShare(b []byte) (Share, error) {
+	if len(b) <= shareOverhead || string(b[:len(MagicBytesShare)]) != MagicBytesShare {
+		return Share{}, errors.New("invalid share")
+	}
+	data := b[:len(b)-checksumSize]
+	h := sha256.Sum256(data)
+	if !bytes.Equal(h[:checksumSize], b[len(data):]) {
+		return Share{}, ErrCorruptShare
+	}
+	data = data[len(MagicBytesShare):]
+	return Share{
+		Threshold:  data[0],
+		Index:      data[1],
+		Commitment: data[2 : 2+commitmentSize],
+		Key:        data[2+commitmentSize : 2+commitmentSize+commitmentKeySize],
+		Value:      data[2+commitmentSize+commitmentKeySize:],
+	}, nil
+}
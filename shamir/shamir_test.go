@@ -0,0 +1,83 @@
+package shamir
+
+import (
+	"bytes"
+	crypto_ran "crypto/rand"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := crypto_ran.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked []Share
+		for _, i := range subset {
+			share, err := ParseShare(shares[i].Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			picked = append(picked, share)
+		}
+		combined, err := Combine(picked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(combined, secret) {
+			t.Fatal("combined secret does not match original for shares", subset)
+		}
+	}
+
+	if _, err := Combine(shares[:2]); err == nil {
+		t.Fatal("expected error for too few shares")
+	}
+
+	encoded := shares[0].Bytes()
+	encoded[10] ^= 1
+	if _, err := ParseShare(encoded); err != ErrCorruptShare {
+		t.Fatal("expected ErrCorruptShare, got", err)
+	}
+
+	changed := append([]Share{}, shares[:3]...)
+	changed[1].Value = append([]byte{}, changed[1].Value...)
+	changed[1].Value[0] ^= 1
+	if _, err := Combine(changed); err != ErrInconsistentShares {
+		t.Fatal("expected ErrInconsistentShares, got", err)
+	}
+
+	changed = append([]Share{}, shares[:3]...)
+	changed[2].Key = append([]byte{}, changed[2].Key...)
+	changed[2].Key[0] ^= 1
+	if _, err := Combine(changed); err != ErrInconsistentShares {
+		t.Fatal("expected ErrInconsistentShares, got", err)
+	}
+
+	other, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The commitment is keyed with a random key, so it can't be used to check a guess of the secret.
+	if bytes.Equal(shares[0].Commitment, other[0].Commitment) {
+		t.Fatal("splits of the same secret have the same commitment")
+	}
+	if _, err := Combine([]Share{shares[0], shares[1], other[2]}); err != ErrMixedShares {
+		t.Fatal("expected ErrMixedShares, got", err)
+	}
+	// Shares with the commitment of another split are not on the same polynomial.
+	other[2].Commitment = shares[0].Commitment
+	if _, err := Combine([]Share{shares[0], shares[1], other[2]}); err != ErrInconsistentShares {
+		t.Fatal("expected ErrInconsistentShares, got", err)
+	}
+	otherSecret, err := Split([]byte("another secret"), 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Combine([]Share{shares[0], shares[1], otherSecret[2]}); err != ErrMixedShares {
+		t.Fatal("expected ErrMixedShares, got", err)
+	}
+}
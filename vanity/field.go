@@ -0,0 +1,167 @@
+package vanity
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// fieldElement is an element of GF(2^255-19), in 5 limbs of 51 bits, least significant first. Limbs can be slightly
+// larger than 51 bits between operations; every operation returns limbs below 2^52.
+type fieldElement [5]uint64
+
+const maskLow51Bits uint64 = (1 << 51) - 1
+
+var feOne = fieldElement{1, 0, 0, 0, 0}
+
+// feFromBytes decodes a little endian field element, ignoring the top bit like X25519 does.
+func feFromBytes(b []byte) fieldElement {
+	return fieldElement{
+		binary.LittleEndian.Uint64(b[0:8]) & maskLow51Bits,
+		binary.LittleEndian.Uint64(b[6:14]) >> 3 & maskLow51Bits,
+		binary.LittleEndian.Uint64(b[12:20]) >> 6 & maskLow51Bits,
+		binary.LittleEndian.Uint64(b[19:27]) >> 1 & maskLow51Bits,
+		binary.LittleEndian.Uint64(b[24:32]) >> 12 & maskLow51Bits,
+	}
+}
+
+// carry brings every limb below 2^52, folding the carry out of the top limb back in as 2^255 = 19.
+func (v fieldElement) carry() fieldElement {
+	c0, c1, c2, c3, c4 := v[0]>>51, v[1]>>51, v[2]>>51, v[3]>>51, v[4]>>51
+	return fieldElement{
+		v[0]&maskLow51Bits + c4*19,
+		v[1]&maskLow51Bits + c0,
+		v[2]&maskLow51Bits + c1,
+		v[3]&maskLow51Bits + c2,
+		v[4]&maskLow51Bits + c3,
+	}
+}
+
+// bytes returns the canonical little endian encoding of v.
+func (v fieldElement) bytes() []byte {
+	v = v.carry()
+	// c is 1 if v is at least 2^255-19, in which case 19 is added and 2^255 dropped to subtract the prime.
+	c := (v[0] + 19) >> 51
+	c = (v[1] + c) >> 51
+	c = (v[2] + c) >> 51
+	c = (v[3] + c) >> 51
+	c = (v[4] + c) >> 51
+	v[0] += 19 * c
+	v[1] += v[0] >> 51
+	v[0] &= maskLow51Bits
+	v[2] += v[1] >> 51
+	v[1] &= maskLow51Bits
+	v[3] += v[2] >> 51
+	v[2] &= maskLow51Bits
+	v[4] += v[3] >> 51
+	v[3] &= maskLow51Bits
+	v[4] &= maskLow51Bits
+
+	out := make([]byte, 32)
+	for i, limb := range v {
+		offset := i * 51
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], limb<<uint(offset%8))
+		for j, b := range buf {
+			if offset/8+j >= len(out) {
+				break
+			}
+			out[offset/8+j] |= b
+		}
+	}
+	return out
+}
+
+func feAdd(a, b fieldElement) fieldElement {
+	return fieldElement{a[0] + b[0], a[1] + b[1], a[2] + b[2], a[3] + b[3], a[4] + b[4]}.carry()
+}
+
+func feSub(a, b fieldElement) fieldElement {
+	// Add 2p first, so the limbs can't go below 0.
+	return fieldElement{
+		a[0] + 0xFFFFFFFFFFFDA - b[0],
+		a[1] + 0xFFFFFFFFFFFFE - b[1],
+		a[2] + 0xFFFFFFFFFFFFE - b[2],
+		a[3] + 0xFFFFFFFFFFFFE - b[3],
+		a[4] + 0xFFFFFFFFFFFFE - b[4],
+	}.carry()
+}
+
+// uint128 holds the sum of products of limbs.
+type uint128 struct {
+	lo, hi uint64
+}
+
+func mulAdd(v uint128, a, b uint64) uint128 {
+	hi, lo := bits.Mul64(a, b)
+	lo, c := bits.Add64(lo, v.lo, 0)
+	hi, _ = bits.Add64(hi, v.hi, c)
+	return uint128{lo, hi}
+}
+
+func (v uint128) shiftRight51() uint64 {
+	return v.hi<<(64-51) | v.lo>>51
+}
+
+func feMul(a, b fieldElement) fieldElement {
+	a1, a2, a3, a4 := a[1]*19, a[2]*19, a[3]*19, a[4]*19
+
+	var r0, r1, r2, r3, r4 uint128
+	r0 = mulAdd(r0, a[0], b[0])
+	r0 = mulAdd(r0, a1, b[4])
+	r0 = mulAdd(r0, a2, b[3])
+	r0 = mulAdd(r0, a3, b[2])
+	r0 = mulAdd(r0, a4, b[1])
+
+	r1 = mulAdd(r1, a[0], b[1])
+	r1 = mulAdd(r1, a[1], b[0])
+	r1 = mulAdd(r1, a2, b[4])
+	r1 = mulAdd(r1, a3, b[3])
+	r1 = mulAdd(r1, a4, b[2])
+
+	r2 = mulAdd(r2, a[0], b[2])
+	r2 = mulAdd(r2, a[1], b[1])
+	r2 = mulAdd(r2, a[2], b[0])
+	r2 = mulAdd(r2, a3, b[4])
+	r2 = mulAdd(r2, a4, b[3])
+
+	r3 = mulAdd(r3, a[0], b[3])
+	r3 = mulAdd(r3, a[1], b[2])
+	r3 = mulAdd(r3, a[2], b[1])
+	r3 = mulAdd(r3, a[3], b[0])
+	r3 = mulAdd(r3, a4, b[4])
+
+	r4 = mulAdd(r4, a[0], b[4])
+	r4 = mulAdd(r4, a[1], b[3])
+	r4 = mulAdd(r4, a[2], b[2])
+	r4 = mulAdd(r4, a[3], b[1])
+	r4 = mulAdd(r4, a[4], b[0])
+
+	// With limbs below 2^52, every sum is below 2^111, so the carries fit in 64 bits even after multiplying by 19.
+	return fieldElement{
+		r0.lo&maskLow51Bits + r4.shiftRight51()*19,
+		r1.lo&maskLow51Bits + r0.shiftRight51(),
+		r2.lo&maskLow51Bits + r1.shiftRight51(),
+		r3.lo&maskLow51Bits + r2.shiftRight51(),
+		r4.lo&maskLow51Bits + r3.shiftRight51(),
+	}.carry()
+}
+
+func feSquare(a fieldElement) fieldElement {
+	return feMul(a, a)
+}
+
+// feInvert returns 1/a, or 0 if a is 0, by raising a to the power p-2 = 2^255-21.
+func feInvert(a fieldElement) fieldElement {
+	// The bits of 2^255-21 are 250 ones followed by 01011.
+	result := feOne
+	for i := 0; i < 250; i++ {
+		result = feMul(feSquare(result), a)
+	}
+	for _, bit := range []bool{false, true, false, true, true} {
+		result = feSquare(result)
+		if bit {
+			result = feMul(result, a)
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package vanity
+
+import (
+	crypto_ran "crypto/rand"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	// Number of keys whose public keys are converted to bytes with a single field inversion.
+	keyStreamBatch = 512
+	// Number of keys derived from one random scalar before a new one is chosen.
+	keyStreamSteps = 1 << 24
+)
+
+// uStep is the u coordinate of 8 times the base point, which is added to step from one public key to the next.
+var uStep = func() fieldElement {
+	// Double the base point, u=9, 3 times with the Montgomery ladder doubling formula from RFC 7748.
+	x, z := fieldElement{9, 0, 0, 0, 0}, feOne
+	for i := 0; i < 3; i++ {
+		aa := feSquare(feAdd(x, z))
+		bb := feSquare(feSub(x, z))
+		e := feSub(aa, bb)
+		x = feMul(aa, bb)
+		z = feMul(e, feAdd(aa, feMul(fieldElement{121665, 0, 0, 0, 0}, e)))
+	}
+	return feMul(x, feInvert(z))
+}()
+
+// keyStream generates key pairs much faster than encryption.GenerateKeys. It starts from a random clamped scalar s,
+// and then steps to s+8, s+16 and so on, which are also valid clamped scalars. Instead of a scalar multiplication for
+// every key, the next public key is found by adding 8 times the base point to the previous one using the differential
+// addition of the Montgomery curve, and the public keys of a whole batch are converted to bytes with one inversion.
+//
+// Every scalar is uniformly random as long as the starting scalars are, since a search stops at a match that does not
+// depend on the scalar. Other keys from the same stream are easy to find from one of them, so a search that keeps going
+// after a match must start a new stream.
+type keyStream struct {
+	scalar []byte
+	// Number of steps taken from scalar, and the number to take before reseeding.
+	steps, maxSteps int
+	// Projective u coordinates of the previous and current public keys.
+	prevX, prevZ, curX, curZ fieldElement
+	// Public keys of the current batch, and the index of the next one to return.
+	batch [][]byte
+	next  int
+	// Temporary space for the batch.
+	xs, zs, products []fieldElement
+}
+
+func newKeyStream() *keyStream {
+	return &keyStream{
+		xs:       make([]fieldElement, keyStreamBatch),
+		zs:       make([]fieldElement, keyStreamBatch),
+		products: make([]fieldElement, keyStreamBatch),
+		batch:    make([][]byte, keyStreamBatch),
+		next:     keyStreamBatch,
+		steps:    keyStreamSteps,
+		maxSteps: keyStreamSteps,
+	}
+}
+
+// addScalar returns the little endian scalar plus n.
+func addScalar(scalar []byte, n uint64) []byte {
+	result := make([]byte, len(scalar))
+	for i, b := range scalar {
+		sum := uint64(b) + n&0xff
+		result[i] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+	return result
+}
+
+// reseed starts again from a new random scalar.
+func (k *keyStream) reseed() error {
+	k.scalar = make([]byte, curve25519.ScalarSize)
+	for {
+		if _, err := crypto_ran.Read(k.scalar); err != nil {
+			return err
+		}
+		k.scalar[0] &= 248
+		k.scalar[31] &= 127
+		k.scalar[31] |= 64
+		// Stepping must not carry into the top bits of the scalar, which almost never happens.
+		if addScalar(k.scalar, 8*uint64(k.maxSteps))[31]&0xc0 == 0x40 {
+			break
+		}
+	}
+	first, err := curve25519.X25519(k.scalar, curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+	second, err := curve25519.X25519(addScalar(k.scalar, 8), curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+	k.prevX, k.prevZ = feFromBytes(first), feOne
+	k.curX, k.curZ = feFromBytes(second), feOne
+	k.steps = 0
+	// The batch starts at the second key, so return the first one by itself.
+	k.batch[keyStreamBatch-1] = first
+	k.next = keyStreamBatch - 1
+	return nil
+}
+
+// fill computes the public keys of the next batch.
+func (k *keyStream) fill() {
+	stepPlus, stepMinus := feAdd(uStep, feOne), feSub(uStep, feOne)
+	for i := range k.xs {
+		k.xs[i], k.zs[i] = k.curX, k.curZ
+		// Differential addition: the sum of the current point and the step, whose difference is the previous point.
+		da := feMul(feSub(k.curX, k.curZ), stepPlus)
+		cb := feMul(feAdd(k.curX, k.curZ), stepMinus)
+		nextX := feMul(k.prevZ, feSquare(feAdd(da, cb)))
+		nextZ := feMul(k.prevX, feSquare(feSub(da, cb)))
+		k.prevX, k.prevZ = k.curX, k.curZ
+		k.curX, k.curZ = nextX, nextZ
+	}
+	// Batched inversion: invert the product of every z, then peel off one z at a time.
+	product := feOne
+	for i, z := range k.zs {
+		k.products[i] = product
+		product = feMul(product, z)
+	}
+	inverse := feInvert(product)
+	for i := len(k.zs) - 1; i >= 0; i-- {
+		k.batch[i] = feMul(k.xs[i], feMul(inverse, k.products[i])).bytes()
+		inverse = feMul(inverse, k.zs[i])
+	}
+	k.next = 0
+}
+
+// Next returns the next key pair. The private key is only computed when wanted, since it is rarely needed.
+func (k *keyStream) Next() (publicKey []byte, privateKey func() []byte, err error) {
+	if k.next == keyStreamBatch {
+		if k.steps+keyStreamBatch > k.maxSteps {
+			if err := k.reseed(); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			k.fill()
+		}
+	}
+	scalar, steps := k.scalar, k.steps
+	publicKey = k.batch[k.next]
+	k.next++
+	k.steps++
+	return publicKey, func() []byte { return addScalar(scalar, 8*uint64(steps)) }, nil
+}
@@ -0,0 +1,84 @@
+package vanity
+
+import (
+	"bytes"
+	crypto_ran "crypto/rand"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"math/big"
+	"testing"
+)
+
+var fieldPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+func feToBig(v fieldElement) *big.Int {
+	b := v.bytes()
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+func TestFieldElement(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		ab := make([]byte, 64)
+		if _, err := crypto_ran.Read(ab); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			// 2^255-20, the largest canonical element.
+			copy(ab, bytes.Repeat([]byte{0xff}, 32))
+			ab[0] = 0xec
+			ab[31] = 0x7f
+		}
+		a, b := feFromBytes(ab[:32]), feFromBytes(ab[32:])
+		x, y := feToBig(a), feToBig(b)
+		check := func(name string, got fieldElement, expected *big.Int) {
+			if feToBig(got).Cmp(expected.Mod(expected, fieldPrime)) != 0 {
+				t.Fatal(name, "mismatch for", x, y)
+			}
+		}
+		check("add", feAdd(a, b), new(big.Int).Add(x, y))
+		check("sub", feSub(a, b), new(big.Int).Sub(x, y))
+		check("mul", feMul(a, b), new(big.Int).Mul(x, y))
+		check("square", feSquare(a), new(big.Int).Mul(x, x))
+		if x.Sign() != 0 {
+			check("invert", feInvert(a), new(big.Int).ModInverse(x, fieldPrime))
+		}
+	}
+}
+
+func TestKeyStream(t *testing.T) {
+	stream := newKeyStream()
+	// Cross several batches and reseeds.
+	stream.maxSteps = 2*keyStreamBatch + 1
+	for i := 0; i < 5*keyStreamBatch; i++ {
+		publicKey, privateKey, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := encryption.GetPublicKey(privateKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(publicKey, expected) {
+			t.Fatal("public key", i, "does not belong to its private key")
+		}
+	}
+}
+
+func BenchmarkGenerateKeys(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, _, err := encryption.GenerateKeys(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKeyStream(b *testing.B) {
+	stream := newKeyStream()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := stream.Next(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package vanity
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Number of significant characters in the base64 encoding of a 32 byte public key. The last one only holds 4 bits, so
+// it is always one of 16 characters.
+const base64KeyLength = 43
+
+// Matcher checks public keys during a Search.
+type Matcher interface {
+	// Match reports whether publicKey matches.
+	Match(publicKey []byte) bool
+	// Probability returns the chance that a random public key matches, or 0 if it is unknown.
+	Probability() float64
+}
+
+// Locator is implemented by matchers that can tell where in the base64 encoding of a public key they matched.
+type Locator interface {
+	// Locate returns the start and end of the match in the base64 encoding of publicKey, or -1 if it does not match.
+	Locate(publicKey []byte) (int, int)
+}
+
+// Base64Pattern matches public keys whose base64 encoding starts with, ends with or contains Text.
+type Base64Pattern struct {
+	// Mode is "prefix", "suffix" or "any".
+	Mode          string
+	Text          string
+	CaseSensitive bool
+}
+
+// NewBase64Pattern returns a Base64Pattern, checking that mode is valid and that text can match a public key.
+func NewBase64Pattern(mode string, text string, caseSensitive bool) (*Base64Pattern, error) {
+	if mode != "prefix" && mode != "suffix" && mode != "any" {
+		return nil, errors.New("invalid mode \"" + mode + "\", must be prefix, suffix or any")
+	}
+	if text == "" {
+		return nil, errors.New("pattern cannot be empty")
+	}
+	for _, r := range text {
+		if !strings.ContainsRune(base64Alphabet, r) {
+			return nil, errors.New("pattern \"" + text + "\" contains \"" + string(r) + "\", which is not in the base64 alphabet (A-Z, a-z, 0-9, + and /)")
+		}
+	}
+	if !caseSensitive {
+		text = strings.ToLower(text)
+	}
+	p := &Base64Pattern{Mode: mode, Text: text, CaseSensitive: caseSensitive}
+	if p.Probability() == 0 {
+		// Such as a suffix ending in a character that can't be last, or a pattern longer than a key.
+		return nil, errors.New("pattern \"" + text + "\" can never match a public key in " + mode + " mode")
+	}
+	return p, nil
+}
+
+// encode returns the significant characters of the base64 encoding of publicKey.
+func (p *Base64Pattern) encode(publicKey []byte) string {
+	s := strings.TrimRight(base64.StdEncoding.EncodeToString(publicKey), "=")
+	if !p.CaseSensitive {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// index returns the position of Text in the base64 encoding of publicKey, or -1 if it does not match.
+func (p *Base64Pattern) index(publicKey []byte) int {
+	s := p.encode(publicKey)
+	switch p.Mode {
+	case "prefix":
+		if strings.HasPrefix(s, p.Text) {
+			return 0
+		}
+	case "suffix":
+		if strings.HasSuffix(s, p.Text) {
+			return len(s) - len(p.Text)
+		}
+	default:
+		return strings.Index(s, p.Text)
+	}
+	return -1
+}
+
+func (p *Base64Pattern) Match(publicKey []byte) bool {
+	return p.index(publicKey) != -1
+}
+
+func (p *Base64Pattern) Locate(publicKey []byte) (int, int) {
+	start := p.index(publicKey)
+	if start == -1 {
+		return -1, -1
+	}
+	return start, start + len(p.Text)
+}
+
+// charProbability returns the chance that the character at position of a random key's base64 encoding matches c.
+func (p *Base64Pattern) charProbability(c byte, position int) float64 {
+	matches, total := 0, 64
+	if position == base64KeyLength-1 {
+		total = 16
+	}
+	for i := 0; i < len(base64Alphabet); i++ {
+		if position == base64KeyLength-1 && i%4 != 0 {
+			// The 2 low bits of the last character are always 0.
+			continue
+		}
+		a := base64Alphabet[i]
+		if a == c || (!p.CaseSensitive && strings.ToLower(string(a)) == string(c)) {
+			matches++
+		}
+	}
+	return float64(matches) / float64(total)
+}
+
+// probabilityAt returns the chance that Text matches a random key's base64 encoding at start.
+func (p *Base64Pattern) probabilityAt(start int) float64 {
+	probability := 1.0
+	for i := 0; i < len(p.Text); i++ {
+		probability *= p.charProbability(p.Text[i], start+i)
+	}
+	return probability
+}
+
+func (p *Base64Pattern) Probability() float64 {
+	if len(p.Text) > base64KeyLength {
+		return 0
+	}
+	switch p.Mode {
+	case "prefix":
+		return p.probabilityAt(0)
+	case "suffix":
+		return p.probabilityAt(base64KeyLength - len(p.Text))
+	}
+	// Sum of the chances at every position, which is close enough when matches are rare.
+	probability := 0.0
+	for start := 0; start+len(p.Text) <= base64KeyLength; start++ {
+		probability += p.probabilityAt(start)
+	}
+	if probability > 1 {
+		probability = 1
+	}
+	return probability
+}
@@ -0,0 +1,58 @@
+package vanity
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"regexp"
+	"strings"
+)
+
+// RegexpPattern matches public keys whose base64 encoding, or humanized words, match a regular expression.
+type RegexpPattern struct {
+	Regexp *regexp.Regexp
+	// If not nil, the regular expression is matched against the words of humanize-key instead of base64, separated by
+	// single spaces.
+	Wordlist *humanize.Wordlist
+}
+
+// NewRegexpPattern compiles expr into a RegexpPattern. If wordlist is not nil, it matches the humanized words of keys.
+func NewRegexpPattern(expr string, caseSensitive bool, wordlist *humanize.Wordlist) (*RegexpPattern, error) {
+	if !caseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.New("invalid regular expression: " + err.Error())
+	}
+	return &RegexpPattern{Regexp: re, Wordlist: wordlist}, nil
+}
+
+func (p *RegexpPattern) encode(publicKey []byte) string {
+	if p.Wordlist != nil {
+		return strings.TrimSpace(p.Wordlist.GetStringChecked(publicKey))
+	}
+	return strings.TrimRight(base64.StdEncoding.EncodeToString(publicKey), "=")
+}
+
+func (p *RegexpPattern) Match(publicKey []byte) bool {
+	return p.Regexp.MatchString(p.encode(publicKey))
+}
+
+// Probability returns 0, since the chance of matching a regular expression is unknown.
+func (p *RegexpPattern) Probability() float64 {
+	return 0
+}
+
+// Locate returns where the regular expression matched the base64 encoding of publicKey, or -1 if it matched the
+// humanized words.
+func (p *RegexpPattern) Locate(publicKey []byte) (int, int) {
+	if p.Wordlist != nil {
+		return -1, -1
+	}
+	loc := p.Regexp.FindStringIndex(p.encode(publicKey))
+	if loc == nil {
+		return -1, -1
+	}
+	return loc[0], loc[1]
+}
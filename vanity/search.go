@@ -0,0 +1,188 @@
+// Package vanity searches for key pairs whose public key matches a pattern.
+package vanity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Attempts are added to the shared counter in batches, so workers don't contend on it.
+const attemptsBatch = 256
+
+// Result is a key pair found by a Search.
+type Result struct {
+	PublicKey  []byte
+	PrivateKey []byte
+	// Index of the matcher in Search.Matchers that matched.
+	Matcher int
+	// Number of keys tried, including this one, by all workers.
+	Attempts uint64
+	Elapsed  time.Duration
+}
+
+// Progress describes a running Search.
+type Progress struct {
+	Attempts uint64
+	Elapsed  time.Duration
+	// Chance that a random public key matches any of the matchers, or 0 if it is unknown.
+	Probability float64
+}
+
+// Rate returns the number of keys tried per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Attempts) / p.Elapsed.Seconds()
+}
+
+// ExpectedAttempts returns the average number of keys that need to be tried to find a match, or 0 if it is unknown.
+func (p Progress) ExpectedAttempts() float64 {
+	if p.Probability <= 0 {
+		return 0
+	}
+	return 1 / p.Probability
+}
+
+// ExpectedSeconds returns the average number of seconds a search takes at the current rate, or 0 if it is unknown.
+// Every attempt is independent, so the expected remaining time does not go down as the search runs.
+func (p Progress) ExpectedSeconds() float64 {
+	rate := p.Rate()
+	if rate == 0 {
+		return 0
+	}
+	return p.ExpectedAttempts() / rate
+}
+
+// Chance returns the chance that a search would have found a match by now, or 0 if it is unknown.
+func (p Progress) Chance() float64 {
+	if p.Probability <= 0 {
+		return 0
+	}
+	return -math.Expm1(float64(p.Attempts) * math.Log1p(-p.Probability))
+}
+
+// Search generates key pairs until one of the public keys matches. Keys are generated by stepping from a random
+// private key, which is much faster than encryption.GenerateKeys (see BenchmarkKeyStream).
+type Search struct {
+	// The search stops when any of the matchers match.
+	Matchers []Matcher
+	// Number of goroutines generating keys. If less than 1, runtime.NumCPU() is used.
+	Workers int
+	// If not nil, Progress is called every ProgressInterval while searching.
+	Progress func(Progress)
+	// If 0, progress is reported every second.
+	ProgressInterval time.Duration
+	// If not nil, Found is called with every match, and the search keeps going until it returns false or the context
+	// is done. If nil, the search stops at the first match.
+	Found func(Result) bool
+}
+
+// Probability returns the chance that a random public key matches any of the matchers, or 0 if it is unknown.
+func (s *Search) Probability() float64 {
+	probability := 0.0
+	for _, m := range s.Matchers {
+		p := m.Probability()
+		if p <= 0 {
+			return 0
+		}
+		probability += p
+	}
+	return math.Min(probability, 1)
+}
+
+// Run searches until a key pair is found or ctx is done, in which case ctx.Err() is returned with the Attempts and
+// Elapsed of the result set.
+func (s *Search) Run(ctx context.Context) (Result, error) {
+	workers := s.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	interval := s.ProgressInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	start := time.Now()
+	var attempts atomic.Uint64
+	found := make(chan Result, workers)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stream := newKeyStream()
+			batch := uint64(0)
+			for ctx.Err() == nil {
+				publicKey, privateKey, err := stream.Next()
+				if err != nil {
+					errs <- err
+					return
+				}
+				batch++
+				if batch == attemptsBatch {
+					attempts.Add(batch)
+					batch = 0
+				}
+				for j, m := range s.Matchers {
+					if m.Match(publicKey) {
+						result := Result{PublicKey: publicKey, PrivateKey: privateKey(), Matcher: j, Attempts: attempts.Add(batch)}
+						batch = 0
+						// Matches are rare, so check them the slow way too.
+						if expected, err := encryption.GetPublicKey(result.PrivateKey); err != nil || !bytes.Equal(expected, publicKey) {
+							errs <- errors.New("generated public key does not match private key")
+							return
+						}
+						select {
+						case found <- result:
+						case <-ctx.Done():
+							return
+						}
+						if s.Found == nil {
+							return
+						}
+						// Keys from the same stream are s+8k for the same s, so anyone given this key could find the
+						// next matches from it. Start again from a new random scalar.
+						stream = newKeyStream()
+						// Report every key once, even if it matches more than one matcher.
+						break
+					}
+				}
+			}
+		}()
+	}
+	// Stop the workers and wait for them before returning.
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case result := <-found:
+			result.Elapsed = time.Since(start)
+			if s.Found == nil || !s.Found(result) {
+				return result, nil
+			}
+		case err := <-errs:
+			return Result{}, err
+		case <-ctx.Done():
+			return Result{Attempts: attempts.Load(), Elapsed: time.Since(start)}, ctx.Err()
+		case <-ticker.C:
+			if s.Progress != nil {
+				s.Progress(Progress{Attempts: attempts.Load(), Elapsed: time.Since(start), Probability: s.Probability()})
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package vanity
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"github.com/masquernya/go-encryption-program/encryption"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestBase64PatternProbability(t *testing.T) {
+	tests := []struct {
+		mode          string
+		text          string
+		caseSensitive bool
+		probability   float64
+	}{
+		{"prefix", "ab", true, 1.0 / 64 / 64},
+		{"prefix", "ab", false, 1.0 / 32 / 32},
+		{"prefix", "a1", false, 1.0 / 32 / 64},
+		// The last character is one of 16, and "A" is one of them.
+		{"suffix", "A", true, 1.0 / 16},
+		{"suffix", "B", true, 0},
+		// "b" can't be the last character, so only 41 of the 42 positions can match.
+		{"any", "ab", true, 41.0 / 64 / 64},
+	}
+	for _, test := range tests {
+		pattern := &Base64Pattern{Mode: test.mode, Text: test.text, CaseSensitive: test.caseSensitive}
+		if probability := pattern.Probability(); math.Abs(probability-test.probability) > 1e-12 {
+			t.Fatal(test.mode, test.text, "expected probability", test.probability, "got", probability)
+		}
+	}
+	if _, err := NewBase64Pattern("middle", "ab", true); err == nil {
+		t.Fatal("expected error for invalid mode")
+	}
+	if _, err := NewBase64Pattern("suffix", "B", true); err == nil {
+		t.Fatal("expected error for pattern that can never match")
+	}
+}
+
+// matchAll matches every public key.
+type matchAll struct{}
+
+func (matchAll) Match(publicKey []byte) bool { return true }
+
+func (matchAll) Probability() float64 { return 1 }
+
+// scalarInt returns the little endian scalar of a private key.
+func scalarInt(privateKey []byte) *big.Int {
+	b := make([]byte, len(privateKey))
+	for i, c := range privateKey {
+		b[len(b)-1-i] = c
+	}
+	return new(big.Int).SetBytes(b)
+}
+
+func TestSearch(t *testing.T) {
+	pattern, err := NewBase64Pattern("prefix", "ab", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := &Search{Matchers: []Matcher{pattern}, Workers: 2}
+	result, err := search.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pattern.Match(result.PublicKey) {
+		t.Fatal("public key does not match")
+	}
+	publicKey, err := encryption.GetPublicKey(result.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(publicKey, result.PublicKey) {
+		t.Fatal("private key does not belong to public key")
+	}
+
+	// Every key matches, so each result is one more attempt than the one before.
+	var results []Result
+	search = &Search{Matchers: []Matcher{matchAll{}}, Workers: 1}
+	search.Found = func(result Result) bool {
+		results = append(results, result)
+		return len(results) < 10
+	}
+	if _, err := search.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		if result.Attempts != uint64(i+1) {
+			t.Fatal("expected", i+1, "attempts for result", i, "got", result.Attempts)
+		}
+	}
+	// Matches must not be s+8k for the same s, or one of them would give away the others.
+	for i := 1; i < len(results); i++ {
+		diff := new(big.Int).Sub(scalarInt(results[i].PrivateKey), scalarInt(results[i-1].PrivateKey))
+		if diff.Abs(diff).Cmp(big.NewInt(8*keyStreamSteps)) < 0 {
+			t.Fatal("results", i-1, "and", i, "are from the same key stream")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	impossible := &Base64Pattern{Mode: "suffix", Text: "B", CaseSensitive: true}
+	search = &Search{Matchers: []Matcher{impossible}}
+	if _, err := search.Run(ctx); err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+}
+
+func TestRegexpPattern(t *testing.T) {
+	pattern, err := NewRegexpPattern("^[a-c]", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordPattern, err := NewRegexpPattern("^(the|of) ", false, humanize.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []Result
+	search := &Search{Matchers: []Matcher{pattern, wordPattern}, Workers: 2}
+	search.Found = func(result Result) bool {
+		results = append(results, result)
+		return len(results) < 5
+	}
+	if _, err := search.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Fatal("expected 5 results, got", len(results))
+	}
+	for _, result := range results {
+		encoded := base64.StdEncoding.EncodeToString(result.PublicKey)
+		words := humanize.GetString(result.PublicKey)
+		if result.Matcher == 0 && !strings.ContainsAny(encoded[:1], "abcABC") {
+			t.Fatal("public key", encoded, "does not match")
+		}
+		if result.Matcher == 1 && !strings.HasPrefix(words, "the ") && !strings.HasPrefix(words, "of ") {
+			t.Fatal("public key", words, "does not match")
+		}
+	}
+
+	if _, err := NewRegexpPattern("((", true, nil); err == nil {
+		t.Fatal("expected error for invalid regular expression")
+	}
+	if _, err := NewBase64Pattern("prefix", "a-b", true); err == nil {
+		t.Fatal("expected error for character outside the base64 alphabet")
+	}
+}
+
+func TestWordsPattern(t *testing.T) {
+	if _, err := NewWordsPattern("prefix", "the havex", humanize.Default); err == nil || !strings.Contains(err.Error(), "did you mean have?") {
+		t.Fatal("expected a suggestion, got", err)
+	}
+	// "adroitness" is only used at odd positions in the PGP list, so it can't start a key.
+	if _, err := NewWordsPattern("prefix", "adroitness", humanize.PGP); err == nil {
+		t.Fatal("expected an error")
+	}
+	anyPattern, err := NewWordsPattern("any", "aardvark", humanize.PGP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "aardvark" is only used at even positions, so it can be at 16 of them.
+	if p := anyPattern.Probability(); p != 16.0/256 {
+		t.Fatal("expected probability", 16.0/256, "got", p)
+	}
+	prefixPattern, err := NewWordsPattern("prefix", "the", humanize.Default)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := prefixPattern.Probability(); p != 1.0/256 {
+		t.Fatal("expected probability", 1.0/256, "got", p)
+	}
+	search := &Search{Matchers: []Matcher{prefixPattern, anyPattern}, Workers: 2}
+	for i := 0; i < 3; i++ {
+		result, err := search.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		words := strings.Fields(humanize.PGP.GetString(result.PublicKey))
+		if result.Matcher == 0 && !strings.HasPrefix(humanize.GetString(result.PublicKey), "the ") {
+			t.Fatal("public key", humanize.GetString(result.PublicKey), "does not match")
+		}
+		found := false
+		for _, word := range words[:32] {
+			found = found || word == "aardvark"
+		}
+		if result.Matcher == 1 && !found {
+			t.Fatal("public key", words, "does not match")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package vanity
+
+import (
+	"bytes"
+	"errors"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"math"
+)
+
+// Number of words in a humanized public key, not counting the checksum words.
+const keyWords = 32
+
+// WordsPattern matches public keys whose humanized words start with, or contain, a sequence of words. Checksum words
+// are not searched.
+type WordsPattern struct {
+	// Mode is "prefix" or "any".
+	Mode string
+	// Bytes of the words when the sequence starts at an even or an odd position. They only differ for word lists like
+	// PGP that use different words at odd positions, and are nil if the words can't start at such a position.
+	even, odd []byte
+}
+
+// NewWordsPattern returns a WordsPattern for the words in s, checking that every word is in wordlist.
+func NewWordsPattern(mode string, s string, wordlist *humanize.Wordlist) (*WordsPattern, error) {
+	if mode != "prefix" && mode != "any" {
+		return nil, errors.New("invalid mode \"" + mode + "\", must be prefix or any")
+	}
+	even, err := wordlist.ParseBytesAt(s, 0)
+	if err != nil && mode == "prefix" {
+		return nil, withSuggestions(err, wordlist, 0)
+	}
+	var odd []byte
+	if mode == "any" {
+		var oddErr error
+		odd, oddErr = wordlist.ParseBytesAt(s, 1)
+		if err != nil && oddErr != nil {
+			return nil, withSuggestions(err, wordlist, 0)
+		}
+	}
+	if len(even) == 0 && len(odd) == 0 {
+		return nil, errors.New("pattern cannot be empty")
+	}
+	if len(even) > keyWords || len(odd) > keyWords {
+		return nil, errors.New("pattern has more words than a public key")
+	}
+	return &WordsPattern{Mode: mode, even: even, odd: odd}, nil
+}
+
+// withSuggestions adds the likely meant words to a *humanize.WordError from parsing words starting at start.
+func withSuggestions(err error, wordlist *humanize.Wordlist, start int) error {
+	if wordErr, ok := err.(*humanize.WordError); ok {
+		resolver := &humanize.Resolver{Wordlist: wordlist}
+		wordErr.Suggestions = resolver.Suggest(wordErr.Word, start+wordErr.Position)
+	}
+	return err
+}
+
+// words returns the bytes of the sequence starting at position, or nil if it can't start there.
+func (p *WordsPattern) words(position int) []byte {
+	if position%2 == 0 {
+		return p.even
+	}
+	return p.odd
+}
+
+func (p *WordsPattern) Match(publicKey []byte) bool {
+	if p.Mode == "prefix" {
+		return bytes.HasPrefix(publicKey, p.even)
+	}
+	for start := 0; start < len(publicKey); start++ {
+		if words := p.words(start); words != nil && bytes.HasPrefix(publicKey[start:], words) {
+			return true
+		}
+	}
+	return false
+}
+
+// Probability returns the chance that the sequence of n words matches, which is 256^-n at each possible position.
+func (p *WordsPattern) Probability() float64 {
+	if p.Mode == "prefix" {
+		return math.Pow(256, -float64(len(p.even)))
+	}
+	probability := 0.0
+	for start := 0; start < keyWords; start++ {
+		if words := p.words(start); words != nil && start+len(words) <= keyWords {
+			probability += math.Pow(256, -float64(len(words)))
+		}
+	}
+	return math.Min(probability, 1)
+}
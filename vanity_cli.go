@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/masquernya/go-encryption-program/humanize"
+	"github.com/masquernya/go-encryption-program/vanity"
+	"golang.org/x/term"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newVanityMatcher returns the matcher for pattern in a genkeyword mode.
+func newVanityMatcher(mode string, pattern string, caseSensitive bool, wordlist *humanize.Wordlist) (vanity.Matcher, error) {
+	switch mode {
+	case "regex":
+		return vanity.NewRegexpPattern(pattern, caseSensitive, nil)
+	case "regex-words":
+		return vanity.NewRegexpPattern(pattern, caseSensitive, wordlist)
+	case "words":
+		return vanity.NewWordsPattern("prefix", pattern, wordlist)
+	case "words-any":
+		return vanity.NewWordsPattern("any", pattern, wordlist)
+	case "prefix", "suffix", "any":
+		return vanity.NewBase64Pattern(mode, pattern, caseSensitive)
+	}
+	return nil, errors.New("invalid mode \"" + mode + "\", must be prefix, suffix, any, regex, regex-words, words or words-any")
+}
+
+// progressWidth is the length of the progress line on the terminal, so it can be overwritten and cleared.
+var progressWidth int
+
+// formatCount formats n with a k, M, G, T, P or E suffix.
+func formatCount(n float64) string {
+	suffixes := []string{"", "k", "M", "G", "T", "P", "E"}
+	i := 0
+	for n >= 1000 && i < len(suffixes)-1 {
+		n /= 1000
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(n, 'f', 1, 64) + suffixes[i]
+}
+
+// formatSeconds formats a duration in seconds, which may be far longer than a time.Duration can hold.
+func formatSeconds(seconds float64) string {
+	switch {
+	case seconds < 60:
+		return strconv.FormatFloat(seconds, 'f', 1, 64) + "s"
+	case seconds < 60*60:
+		return strconv.FormatFloat(seconds/60, 'f', 1, 64) + " minutes"
+	case seconds < 60*60*24:
+		return strconv.FormatFloat(seconds/60/60, 'f', 1, 64) + " hours"
+	case seconds < 60*60*24*365:
+		return strconv.FormatFloat(seconds/60/60/24, 'f', 1, 64) + " days"
+	}
+	return formatCount(seconds/60/60/24/365) + " years"
+}
+
+// printSearchDifficulty prints how many keys a search is expected to try.
+func (c *cli) printSearchDifficulty(search *vanity.Search) {
+	probability := search.Probability()
+	if probability <= 0 {
+		fmt.Fprintln(c.stderr, "Searching, the expected number of attempts is unknown")
+		return
+	}
+	fmt.Fprintln(c.stderr, "Searching, expecting about "+formatCount(1/probability)+" attempts")
+}
+
+// newProgressPrinter returns a function for vanity.Search.Progress that prints progress to stderr. On a terminal, the
+// progress line is overwritten every time.
+func (c *cli) newProgressPrinter() func(vanity.Progress) {
+	file, ok := c.stderr.(*os.File)
+	isTerminal := ok && term.IsTerminal(int(file.Fd()))
+	return func(p vanity.Progress) {
+		line := formatCount(float64(p.Attempts)) + " attempts in " + formatSeconds(p.Elapsed.Seconds()) + ", " + formatCount(p.Rate()) + "/s"
+		if p.Probability > 0 {
+			line += ", expected time " + formatSeconds(p.ExpectedSeconds()) + ", " + strconv.FormatFloat(p.Chance()*100, 'f', 0, 64) + "% chance by now"
+		}
+		if !isTerminal {
+			fmt.Fprintln(c.stderr, line)
+			return
+		}
+		padding := ""
+		if progressWidth > len(line) {
+			padding = strings.Repeat(" ", progressWidth-len(line))
+		}
+		fmt.Fprint(c.stderr, "\r"+line+padding)
+		progressWidth = len(line)
+	}
+}
+
+// clearProgress removes the progress line from the terminal.
+func (c *cli) clearProgress() {
+	if progressWidth > 0 {
+		fmt.Fprint(c.stderr, "\r"+strings.Repeat(" ", progressWidth)+"\r")
+		progressWidth = 0
+	}
+}